@@ -1,12 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	_ "time/tzdata" // tutors' time zones must not depend on the host
 
 	"github.com/OPTIC7409/tutor-api/config"
 	"github.com/OPTIC7409/tutor-api/internal/database"
+	"github.com/OPTIC7409/tutor-api/internal/geocode"
 	"github.com/OPTIC7409/tutor-api/internal/handlers"
+	"github.com/OPTIC7409/tutor-api/internal/loginguard"
+	"github.com/OPTIC7409/tutor-api/internal/mailer"
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
+	"github.com/OPTIC7409/tutor-api/internal/scope"
+	"github.com/OPTIC7409/tutor-api/internal/signing"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/websocket/v2"
@@ -23,6 +33,28 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	m, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+
+	geocoder, err := geocode.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize geocoder: %v", err)
+	}
+
+	attemptStore, err := loginguard.NewStore(cfg, db)
+	if err != nil {
+		log.Fatalf("Failed to initialize login attempt store: %v", err)
+	}
+	limiter := loginguard.NewLimiter(attemptStore)
+
+	keys, err := signing.NewKeyManager(db, signing.DefaultOptions(cfg.JWTSigningAlgorithm, cfg.JWTKeyRotation))
+	if err != nil {
+		log.Fatalf("Failed to initialize signing keys: %v", err)
+	}
+	go keys.Run(context.Background())
+
 	app := fiber.New()
 
 	app.Use(cors.New())
@@ -51,39 +83,131 @@ func main() {
 		}
 	}))
 
-	authHandler := handlers.NewAuthHandler(db)
-	tutorHandler := handlers.NewTutorHandler(db)
-	studentHandler := handlers.NewStudentHandler(db)
+	authHandler := handlers.NewAuthHandler(db, m, cfg, limiter, keys)
+	tutorHandler := handlers.NewTutorHandler(db, geocoder)
+	studentHandler := handlers.NewStudentHandler(db, geocoder)
 	chatHandler := handlers.NewChatHandler(db)
 	userHandler := handlers.NewUserHandler(db)
+	adminHandler := handlers.NewAdminHandler(db, limiter)
+	organisationHandler := handlers.NewOrganisationHandler(db)
+	sessionHandler := handlers.NewSessionHandler(db)
+	calendarHandler := handlers.NewCalendarHandler(db)
+	requestHandler := handlers.NewRequestHandler(db)
+	subjectHandler := handlers.NewSubjectHandler(db)
+	app.Get("/.well-known/jwks.json", authHandler.JWKS)
+
 	api := app.Group("/api")
+	protected := middleware.Protected(db, keys)
+
+	// Only full logins may manage the account; scoped tokens and API keys
+	// never carry this scope
+	account := policy.RequireScope(scope.Account)
 
 	auth := api.Group("/auth")
 	auth.Post("/register", authHandler.Register)
 	auth.Post("/login", authHandler.Login)
-
-	tutors := api.Group("/tutors")
-	tutors.Post("/", tutorHandler.CreateTutor)
-	tutors.Get("/", tutorHandler.GetTutors)
-	tutors.Get("/:id", tutorHandler.GetTutor)
-	tutors.Put("/:id", tutorHandler.UpdateTutor)
-	tutors.Delete("/:id", tutorHandler.DeleteTutor)
-
-	students := api.Group("/students")
-	students.Post("/", studentHandler.CreateStudent)
-	students.Get("/", studentHandler.GetStudents)
-	students.Get("/:id", studentHandler.GetStudent)
-	students.Put("/:id", studentHandler.UpdateStudent)
-	students.Delete("/:id", studentHandler.DeleteStudent)
-
-	chats := api.Group("/chats")
-	chats.Get("/", chatHandler.GetChats)
-	chats.Get("/:id", chatHandler.GetChat)
-	chats.Post("/", chatHandler.CreateChat)
-	chats.Post("/:id/messages", chatHandler.SendMessage)
-
-	user := api.Group("/user")
-	user.Get("/dashboard", userHandler.GetDashboardData)
+	auth.Post("/login/mfa", authHandler.LoginMFA)
+	auth.Get("/oidc/:provider/login", authHandler.OIDCLogin)
+	auth.Get("/oidc/:provider/callback", authHandler.OIDCCallback)
+	auth.Post("/refresh", authHandler.Refresh)
+	auth.Post("/forgot-password", authHandler.ForgotPassword)
+	auth.Post("/reset-password", authHandler.ResetPassword)
+	auth.Post("/verify-email", authHandler.VerifyEmail)
+	auth.Post("/resend-verification", protected, account, authHandler.ResendVerification)
+	auth.Post("/logout", protected, account, authHandler.Logout)
+	auth.Post("/logout-all", protected, account, authHandler.LogoutAll)
+	auth.Get("/sessions", protected, account, authHandler.GetSessions)
+	auth.Delete("/sessions/:id", protected, account, authHandler.DeleteSession)
+	auth.Post("/2fa/enroll", protected, account, policy.RequireRole(models.UserTypeTutor, models.UserTypeAdmin), authHandler.EnrollTwoFactor)
+	auth.Post("/2fa/confirm", protected, account, authHandler.ConfirmTwoFactor)
+	auth.Post("/2fa/disable", protected, account, authHandler.DisableTwoFactor)
+	auth.Post("/tokens", protected, account, authHandler.CreateScopedToken)
+
+	tutors := api.Group("/tutors", protected)
+	tutors.Post("/", policy.RequireScope(scope.TutorsWrite), policy.RequireRole(models.UserTypeTutor, models.UserTypeAdmin), policy.RequireVerifiedEmail(), tutorHandler.CreateTutor)
+	tutors.Get("/", policy.RequireScope(scope.TutorsRead), tutorHandler.GetTutors)
+	tutors.Get("/search", policy.RequireScope(scope.TutorsRead), tutorHandler.SearchTutors)
+	tutors.Get("/:id", policy.RequireScope(scope.TutorsRead), tutorHandler.GetTutor)
+	tutors.Put("/:id", policy.RequireScope(scope.TutorsWrite), tutorHandler.UpdateTutor)
+	tutors.Delete("/:id", policy.RequireScope(scope.TutorsWrite), tutorHandler.DeleteTutor)
+	tutors.Get("/:id/reviews", policy.RequireScope(scope.TutorsRead), tutorHandler.GetReviews)
+	tutors.Get("/:id/subjects", policy.RequireScope(scope.TutorsRead), tutorHandler.GetTutorSubjects)
+	tutors.Put("/:id/subjects", policy.RequireScope(scope.TutorsWrite), tutorHandler.SetTutorSubjects)
+	tutors.Get("/:id/availability", policy.RequireScope(scope.TutorsRead), tutorHandler.GetAvailability)
+	tutors.Put("/:id/availability", policy.RequireScope(scope.TutorsWrite), tutorHandler.SetAvailability)
+	tutors.Get("/:id/availability/exceptions", policy.RequireScope(scope.TutorsRead), tutorHandler.GetAvailabilityExceptions)
+	tutors.Post("/:id/availability/exceptions", policy.RequireScope(scope.TutorsWrite), tutorHandler.CreateAvailabilityException)
+	tutors.Delete("/:id/availability/exceptions/:exceptionId", policy.RequireScope(scope.TutorsWrite), tutorHandler.DeleteAvailabilityException)
+
+	students := api.Group("/students", protected)
+	students.Post("/", policy.RequireScope(scope.StudentsWrite), policy.RequireRole(models.UserTypeStudent, models.UserTypeAdmin), studentHandler.CreateStudent)
+	students.Get("/", policy.RequireScope(scope.StudentsRead), policy.RequireRole(models.UserTypeAdmin), studentHandler.GetStudents)
+	students.Get("/:id", policy.RequireScope(scope.StudentsRead), studentHandler.GetStudent)
+	students.Put("/:id", policy.RequireScope(scope.StudentsWrite), studentHandler.UpdateStudent)
+	students.Delete("/:id", policy.RequireScope(scope.StudentsWrite), studentHandler.DeleteStudent)
+	students.Get("/:id/subjects", policy.RequireScope(scope.StudentsRead), studentHandler.GetStudentSubjects)
+	students.Put("/:id/subjects", policy.RequireScope(scope.StudentsWrite), studentHandler.SetStudentSubjects)
+
+	subjects := api.Group("/subjects", protected)
+	subjects.Get("/", policy.RequireScope(scope.SubjectsRead), subjectHandler.GetSubjects)
+	subjects.Get("/:id", policy.RequireScope(scope.SubjectsRead), subjectHandler.GetSubject)
+
+	chats := api.Group("/chats", protected)
+	chats.Get("/", policy.RequireScope(scope.ChatsRead), chatHandler.GetChats)
+	chats.Get("/:id", policy.RequireScope(scope.ChatsRead), chatHandler.GetChat)
+	chats.Post("/", policy.RequireScope(scope.ChatsWrite), policy.RequireVerifiedEmail(), chatHandler.CreateChat)
+	chats.Post("/:id/messages", policy.RequireScope(scope.ChatsWrite), chatHandler.SendMessage)
+
+	sessions := api.Group("/sessions", protected)
+	sessions.Post("/", policy.RequireScope(scope.SessionsWrite), policy.RequireRole(models.UserTypeStudent, models.UserTypeAdmin), sessionHandler.RequestSession)
+	sessions.Post("/hold", policy.RequireScope(scope.SessionsWrite), policy.RequireRole(models.UserTypeStudent, models.UserTypeAdmin), sessionHandler.HoldSession)
+	sessions.Get("/", policy.RequireScope(scope.SessionsRead), sessionHandler.GetSessions)
+	sessions.Post("/series", policy.RequireScope(scope.SessionsWrite), policy.RequireRole(models.UserTypeStudent, models.UserTypeAdmin), sessionHandler.CreateSeries)
+	sessions.Get("/series/:id", policy.RequireScope(scope.SessionsRead), sessionHandler.GetSeries)
+	sessions.Get("/:id.ics", policy.RequireScope(scope.SessionsRead), sessionHandler.ExportSession)
+	sessions.Get("/:id", policy.RequireScope(scope.SessionsRead), sessionHandler.GetSession)
+	sessions.Post("/:id/book", policy.RequireScope(scope.SessionsWrite), sessionHandler.BookSession)
+	sessions.Post("/:id/confirm", policy.RequireScope(scope.SessionsWrite), sessionHandler.ConfirmSession)
+	sessions.Post("/:id/reschedule", policy.RequireScope(scope.SessionsWrite), sessionHandler.RescheduleSession)
+	sessions.Post("/:id/cancel", policy.RequireScope(scope.SessionsWrite), sessionHandler.CancelSession)
+	sessions.Post("/:id/complete", policy.RequireScope(scope.SessionsWrite), sessionHandler.CompleteSession)
+	sessions.Post("/:id/review", policy.RequireScope(scope.SessionsWrite), sessionHandler.ReviewSession)
+
+	requests := api.Group("/requests", protected)
+	requests.Post("/", policy.RequireScope(scope.RequestsWrite), policy.RequireRole(models.UserTypeStudent, models.UserTypeAdmin), requestHandler.CreateRequest)
+	requests.Get("/", policy.RequireScope(scope.RequestsRead), requestHandler.GetRequests)
+	requests.Get("/:id", policy.RequireScope(scope.RequestsRead), requestHandler.GetRequest)
+	requests.Post("/:id/accept", policy.RequireScope(scope.RequestsWrite), policy.RequireVerifiedEmail(), requestHandler.AcceptRequest)
+	requests.Post("/:id/decline", policy.RequireScope(scope.RequestsWrite), requestHandler.DeclineRequest)
+	requests.Post("/:id/counter", policy.RequireScope(scope.RequestsWrite), policy.RequireRole(models.UserTypeTutor), requestHandler.CounterRequest)
+	requests.Post("/:id/withdraw", policy.RequireScope(scope.RequestsWrite), requestHandler.WithdrawRequest)
+
+	user := api.Group("/user", protected)
+	user.Get("/dashboard", policy.RequireScope(scope.DashboardRead), userHandler.GetDashboardData)
+	user.Put("/password", account, authHandler.ChangePassword)
+	user.Put("/email", account, authHandler.ChangeEmail)
+	user.Put("/time-zone", account, userHandler.SetTimeZone)
+	user.Post("/calendar", account, calendarHandler.CreateFeed)
+	user.Delete("/calendar", account, calendarHandler.DeleteFeed)
+
+	// Calendar apps fetch the feed without credentials
+	api.Get("/calendar/:token.ics", calendarHandler.GetFeed)
+
+	organisations := api.Group("/organisations", protected, account)
+	organisations.Post("/", policy.RequireRole(models.UserTypeAdmin), organisationHandler.CreateOrganisation)
+	organisations.Get("/:id", organisationHandler.GetOrganisation)
+	organisations.Post("/:id/members", policy.RequireRole(models.UserTypeAdmin), organisationHandler.AddMember)
+	organisations.Delete("/:id/members/:userId", policy.RequireRole(models.UserTypeAdmin), organisationHandler.RemoveMember)
+	organisations.Get("/:id/api-keys", organisationHandler.GetAPIKeys)
+	organisations.Post("/:id/api-keys", organisationHandler.CreateAPIKey)
+	organisations.Delete("/:id/api-keys/:keyId", organisationHandler.RevokeAPIKey)
+
+	admin := api.Group("/admin", protected, policy.RequireScope(scope.Admin), policy.RequireRole(models.UserTypeAdmin))
+	admin.Post("/users/:id/logout-all", adminHandler.LogoutUser)
+	admin.Post("/users/:id/unlock", adminHandler.UnlockUser)
+	admin.Post("/subjects", subjectHandler.CreateSubject)
+	admin.Put("/subjects/:id", subjectHandler.UpdateSubject)
+	admin.Delete("/subjects/:id", subjectHandler.DeleteSubject)
 
 	port := os.Getenv("SERVER_PORT")
 	if port == "" {
@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -15,6 +17,41 @@ type Config struct {
 	DBPassword string
 	DBName     string
 	ServerPort string
+
+	// AppURL is the public URL of the frontend, used to build links in emails
+	AppURL       string
+	MailDriver   string
+	MailDir      string
+	MailFrom     string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+
+	OIDCProviders []OIDCProviderConfig
+
+	// LoginAttemptStore is where failed login counters are kept
+	LoginAttemptStore string
+
+	// JWTSigningAlgorithm is RS256 or EdDSA; keys are replaced every
+	// JWTKeyRotation
+	JWTSigningAlgorithm string
+	JWTKeyRotation      time.Duration
+
+	// Geocoder turns profile locations into coordinates: static or
+	// nominatim
+	Geocoder          string
+	GeocoderURL       string
+	GeocoderUserAgent string
+}
+
+// OIDCProviderConfig configures one "Sign in with ..." provider.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
 }
 
 func LoadConfig() (*Config, error) {
@@ -27,6 +64,22 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	smtpPort := 587
+	if port := os.Getenv("SMTP_PORT"); port != "" {
+		smtpPort, err = strconv.Atoi(port)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keyRotation := 30 * 24 * time.Hour
+	if rotation := os.Getenv("JWT_KEY_ROTATION"); rotation != "" {
+		keyRotation, err = time.ParseDuration(rotation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &Config{
 		DBHost:     os.Getenv("DB_HOST"),
 		DBPort:     dbPort,
@@ -34,9 +87,58 @@ func LoadConfig() (*Config, error) {
 		DBPassword: os.Getenv("DB_PASSWORD"),
 		DBName:     os.Getenv("DB_NAME"),
 		ServerPort: os.Getenv("SERVER_PORT"),
+
+		AppURL:       getEnv("APP_URL", "http://localhost:3000"),
+		MailDriver:   os.Getenv("MAIL_DRIVER"),
+		MailDir:      os.Getenv("MAIL_DIR"),
+		MailFrom:     getEnv("MAIL_FROM", "no-reply@localhost"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     smtpPort,
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+
+		OIDCProviders: loadOIDCProviders(),
+
+		LoginAttemptStore: os.Getenv("LOGIN_ATTEMPT_STORE"),
+
+		JWTSigningAlgorithm: getEnv("JWT_SIGNING_ALG", "RS256"),
+		JWTKeyRotation:      keyRotation,
+
+		Geocoder:          os.Getenv("GEOCODER"),
+		GeocoderURL:       getEnv("GEOCODER_URL", "https://nominatim.openstreetmap.org"),
+		GeocoderUserAgent: getEnv("GEOCODER_USER_AGENT", "tutor-api"),
 	}, nil
 }
 
+// loadOIDCProviders reads OIDC_PROVIDERS, a comma separated list of provider
+// names, and the OIDC_<NAME>_* variables for each of them.
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		})
+	}
+	return providers
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
 func loadEnv() error {
 	err := godotenv.Load()
 	if err == nil {
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -59,11 +60,191 @@ func InitDatabase(cfg *config.Config) (*gorm.DB, error) {
 }
 
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	// Accounts created before email verification existed are trusted
+	grandfatherVerification := db.Migrator().HasTable(&models.User{}) &&
+		!db.Migrator().HasColumn(&models.User{}, "email_verified_at")
+	// Profiles created before the subject catalogue list subjects as text
+	linkSubjects := !db.Migrator().HasTable(&models.TutorSubject{})
+
+	err := db.AutoMigrate(
 		&models.User{},
 		&models.Tutor{},
 		&models.Student{},
 		&models.Chat{},
 		&models.Message{},
+		&models.AuthSession{},
+		&models.RefreshToken{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.RecoveryCode{},
+		&models.ExternalIdentity{},
+		&models.OIDCLoginState{},
+		&models.LoginAttempt{},
+		&models.AuditLog{},
+		&models.SigningKey{},
+		&models.Organisation{},
+		&models.APIKey{},
+		&models.SessionSeries{},
+		&models.Session{},
+		&models.AvailabilityWindow{},
+		&models.AvailabilityException{},
+		&models.CalendarFeed{},
+		&models.TutoringRequest{},
+		&models.Subject{},
+		&models.TutorSubject{},
+		&models.StudentSubject{},
+		&models.Review{},
 	)
+	if err != nil {
+		return err
+	}
+
+	if grandfatherVerification {
+		if err := db.Model(&models.User{}).Where("email_verified_at IS NULL").
+			Update("email_verified_at", gorm.Expr("created_at")).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := migrateLegacyTokens(db); err != nil {
+		return err
+	}
+
+	if linkSubjects {
+		if err := db.Transaction(migrateFreeTextSubjects); err != nil {
+			return err
+		}
+	}
+
+	if err := db.Transaction(enableTutorSearch); err != nil {
+		return err
+	}
+
+	return preventOverlappingSessions(db)
+}
+
+// migrateLegacyTokens drops the single users.token column replaced by
+// auth_sessions, along with refresh tokens issued before sessions existed.
+func migrateLegacyTokens(db *gorm.DB) error {
+	if db.Migrator().HasColumn(&models.User{}, "token") {
+		if err := db.Migrator().DropColumn(&models.User{}, "token"); err != nil {
+			return err
+		}
+	}
+
+	return db.Where("session_id IS NULL").Delete(&models.RefreshToken{}).Error
+}
+
+// migrateFreeTextSubjects links tutors and students to catalogue subjects
+// parsed from their free-text subject fields, adding subjects the
+// catalogue does not have yet.
+func migrateFreeTextSubjects(tx *gorm.DB) error {
+	var tutors []models.Tutor
+	if err := tx.Find(&tutors).Error; err != nil {
+		return err
+	}
+	for _, tutor := range tutors {
+		for _, names := range models.SplitSubjects(tutor.Subject) {
+			subject, err := findOrCreateSubject(tx, names)
+			if err != nil {
+				return err
+			}
+			link := models.TutorSubject{TutorID: tutor.ID, SubjectID: subject.ID}
+			if err := tx.FirstOrCreate(&link, link).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	var students []models.Student
+	if err := tx.Find(&students).Error; err != nil {
+		return err
+	}
+	for _, student := range students {
+		for _, names := range models.SplitSubjects(student.Subjects) {
+			subject, err := findOrCreateSubject(tx, names)
+			if err != nil {
+				return err
+			}
+			link := models.StudentSubject{StudentID: student.ID, SubjectID: subject.ID}
+			if err := tx.FirstOrCreate(&link, link).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// findOrCreateSubject returns the subject at the end of a path of names,
+// matching existing subjects regardless of case and creating the rest.
+func findOrCreateSubject(tx *gorm.DB, names []string) (models.Subject, error) {
+	var subject models.Subject
+	var parentID *uint
+	path := ""
+	for _, name := range names {
+		if path != "" {
+			path += models.SubjectPathSeparator
+		}
+		path += name
+
+		err := tx.Where("lower(path) = lower(?)", path).First(&subject).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			subject = models.Subject{ParentID: parentID, Name: name, Path: path}
+			err = tx.Create(&subject).Error
+		}
+		if err != nil {
+			return models.Subject{}, err
+		}
+
+		// Later names hang off the catalogue's spelling
+		path = subject.Path
+		id := subject.ID
+		parentID = &id
+	}
+	return subject, nil
+}
+
+// enableTutorSearch adds the columns behind full-text tutor search, which
+// models.RefreshTutorSearch keeps up to date, with their indexes, and fills
+// them in for existing tutors.
+func enableTutorSearch(tx *gorm.DB) error {
+	if tx.Migrator().HasColumn(&models.Tutor{}, "search_document") {
+		return nil
+	}
+
+	for _, statement := range []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"ALTER TABLE tutors ADD COLUMN search_document tsvector, ADD COLUMN search_text text NOT NULL DEFAULT ''",
+		"CREATE INDEX idx_tutors_search_document ON tutors USING gin (search_document)",
+		"CREATE INDEX idx_tutors_search_text ON tutors USING gin (search_text gin_trgm_ops)",
+	} {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	return models.RefreshTutorSearch(tx, tx.Model(&models.Tutor{}).Select("id"))
+}
+
+// preventOverlappingSessions adds an exclusion constraint so a tutor can
+// never have two active sessions at the same time, even when bookings race.
+func preventOverlappingSessions(db *gorm.DB) error {
+	var exists bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = ?)", models.SessionOverlapConstraint).
+		Scan(&exists).Error; err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS btree_gist").Error; err != nil {
+		return err
+	}
+
+	return db.Exec(fmt.Sprintf(`ALTER TABLE sessions ADD CONSTRAINT %s EXCLUDE USING gist (
+		tutor_id WITH =,
+		tstzrange(start_time, end_time) WITH &&
+	) WHERE (status IN ('held', 'requested', 'confirmed'))`, models.SessionOverlapConstraint)).Error
 }
@@ -0,0 +1,37 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/OPTIC7409/tutor-api/config"
+)
+
+// ErrNotFound is returned for places a Geocoder does not know, such as
+// "Online".
+var ErrNotFound = errors.New("place not found")
+
+// Point is a position in decimal degrees.
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Geocoder turns a free-text place such as "Cambridge, UK" into
+// coordinates.
+type Geocoder interface {
+	Geocode(ctx context.Context, place string) (Point, error)
+}
+
+// New returns the Geocoder selected by cfg.Geocoder.
+func New(cfg *config.Config) (Geocoder, error) {
+	switch cfg.Geocoder {
+	case "nominatim":
+		return NewNominatim(cfg.GeocoderURL, cfg.GeocoderUserAgent), nil
+	case "static", "":
+		return NewStatic(), nil
+	default:
+		return nil, fmt.Errorf("unknown geocoder %q", cfg.Geocoder)
+	}
+}
@@ -0,0 +1,69 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Nominatim looks places up with the OpenStreetMap Nominatim API. The
+// public server allows one request a second and requires a User-Agent that
+// identifies the application.
+type Nominatim struct {
+	BaseURL   string
+	UserAgent string
+	Client    *http.Client
+}
+
+func NewNominatim(baseURL, userAgent string) *Nominatim {
+	return &Nominatim{
+		BaseURL:   strings.TrimSuffix(baseURL, "/"),
+		UserAgent: userAgent,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *Nominatim) Geocode(ctx context.Context, place string) (Point, error) {
+	query := url.Values{"q": {place}, "format": {"jsonv2"}, "limit": {"1"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.BaseURL+"/search?"+query.Encode(), nil)
+	if err != nil {
+		return Point{}, err
+	}
+	req.Header.Set("User-Agent", n.UserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return Point{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Point{}, fmt.Errorf("nominatim returned %s", resp.Status)
+	}
+
+	var results []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return Point{}, err
+	}
+	if len(results) == 0 {
+		return Point{}, ErrNotFound
+	}
+
+	lat, err := strconv.ParseFloat(results[0].Lat, 64)
+	if err != nil {
+		return Point{}, err
+	}
+	lng, err := strconv.ParseFloat(results[0].Lon, 64)
+	if err != nil {
+		return Point{}, err
+	}
+	return Point{Lat: lat, Lng: lng}, nil
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/OPTIC7409/tutor-api/internal/loginguard"
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type AdminHandler struct {
+	DB      *gorm.DB
+	Limiter *loginguard.Limiter
+}
+
+func NewAdminHandler(db *gorm.DB, limiter *loginguard.Limiter) *AdminHandler {
+	return &AdminHandler{DB: db, Limiter: limiter}
+}
+
+// LogoutUser revokes every session of a user, e.g. when support suspects
+// the account has been compromised.
+func (h *AdminHandler) LogoutUser(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var user models.User
+	if err := h.DB.First(&user, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if err := revokeAllSessions(h.DB, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to logout user"})
+	}
+
+	log.Printf("Admin %d logged out user %d everywhere", middleware.CurrentUser(c).ID, user.ID)
+	return c.JSON(fiber.Map{"message": "User logged out of all devices"})
+}
+
+// UnlockUser lifts a login lockout before it expires on its own.
+func (h *AdminHandler) UnlockUser(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var user models.User
+	if err := h.DB.First(&user, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if err := h.Limiter.Accounts.Unlock(c.Context(), loginguard.AccountKey(user.Email)); err != nil {
+		log.Printf("Error unlocking user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unlock user"})
+	}
+
+	actorID := middleware.CurrentUser(c).ID
+	recordAudit(h.DB, models.AuditLog{
+		UserID:    &user.ID,
+		ActorID:   &actorID,
+		Action:    models.AuditAccountUnlocked,
+		IPAddress: c.IP(),
+	})
+
+	return c.JSON(fiber.Map{"message": "User unlocked"})
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// recordAudit stores an audit entry. Failures are logged rather than
+// returned so that auditing never breaks the request being audited.
+func recordAudit(db *gorm.DB, entry models.AuditLog) {
+	if err := db.Create(&entry).Error; err != nil {
+		log.Printf("Error recording audit entry %s: %v", entry.Action, err)
+	}
+}
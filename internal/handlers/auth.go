@@ -1,53 +1,113 @@
 package handlers
 
 import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"log"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/OPTIC7409/tutor-api/config"
+	"github.com/OPTIC7409/tutor-api/internal/loginguard"
+	"github.com/OPTIC7409/tutor-api/internal/mailer"
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
 	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/oidc"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
+	"github.com/OPTIC7409/tutor-api/internal/scheduling"
+	"github.com/OPTIC7409/tutor-api/internal/signing"
 	"github.com/OPTIC7409/tutor-api/internal/utils"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	DB *gorm.DB
+	DB            *gorm.DB
+	Mailer        mailer.Mailer
+	Config        *config.Config
+	OIDCProviders map[string]*oidc.Provider
+	Limiter       *loginguard.Limiter
+	Keys          *signing.KeyManager
 }
 
-func NewAuthHandler(db *gorm.DB) *AuthHandler {
-	return &AuthHandler{DB: db}
+func NewAuthHandler(db *gorm.DB, m mailer.Mailer, cfg *config.Config, limiter *loginguard.Limiter, keys *signing.KeyManager) *AuthHandler {
+	providers := make(map[string]*oidc.Provider, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		providers[p.Name] = oidc.NewProvider(p.Name, p.Issuer, p.ClientID, p.ClientSecret, p.RedirectURL)
+	}
+
+	return &AuthHandler{DB: db, Mailer: m, Config: cfg, OIDCProviders: providers, Limiter: limiter, Keys: keys}
 }
 
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
-	var user models.User
-	if err := c.BodyParser(&user); err != nil {
+	var input struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		UserType string `json:"userType"`
+		TimeZone string `json:"timeZone"`
+	}
+	if err := c.BodyParser(&input); err != nil {
 		log.Printf("Error parsing request body: %v", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	user.Password = strings.TrimSpace(user.Password)
+	// Everything else about the account, such as its organisation, is set by
+	// the server
+	user := models.User{
+		Name:     input.Name,
+		Email:    input.Email,
+		Password: strings.TrimSpace(input.Password),
+		UserType: input.UserType,
+		TimeZone: input.TimeZone,
+	}
+
+	if len(user.Password) < minPasswordLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Password must be at least %d characters", minPasswordLength)})
+	}
+
+	if !models.IsValidUserType(user.UserType) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "userType must be either \"student\" or \"tutor\""})
+	}
+
+	// Admin accounts are never self-service
+	if user.UserType == models.UserTypeAdmin {
+		return policy.Forbidden(c)
+	}
+
+	if user.TimeZone == "" {
+		user.TimeZone = "UTC"
+	}
+	if _, err := scheduling.LoadLocation(user.TimeZone); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown time zone " + strconv.Quote(user.TimeZone)})
+	}
 
-	// The User model's BeforeCreate hook will handle password hashing
+	// The User model's BeforeSave hook will handle password hashing
 	result := h.DB.Create(&user)
 	if result.Error != nil {
 		log.Printf("Error creating user: %v", result.Error)
-		if result.Error.Error() == "ERROR: duplicate key value violates unique constraint \"uni_users_email\" (SQLSTATE 23505)" {
+		if isDuplicateEmail(result.Error) {
 			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Email already exists"})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create user"})
 	}
 
+	if err := h.sendVerificationEmail(&user, user.Email); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", user.ID, err)
+	}
+
 	log.Printf("User registered successfully with ID: %d", user.ID)
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "User registered successfully", "user_id": user.ID})
 }
 
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		DeviceName string `json:"deviceName"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -56,48 +116,297 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 
 	input.Password = strings.TrimSpace(input.Password)
 
+	if throttled, err := h.loginThrottled(c, input.Email); throttled {
+		return err
+	}
+
 	var user models.User
 	result := h.DB.Where("email = ?", input.Email).First(&user)
 	if result.Error != nil {
+		h.loginFailed(c, input.Email, nil)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
 	}
 
 	// Use the User model's ComparePassword method
 	err := user.ComparePassword(input.Password)
 	if err != nil {
+		h.loginFailed(c, input.Email, &user)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
 	}
 
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["user_id"] = user.ID
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
+	// The password is right; the MFA step keeps counting its own failures
+	// against the same account until the code is also accepted.
+	if user.TOTPEnabled {
+		return h.mfaChallenge(c, &user)
+	}
+
+	h.loginSucceeded(c, input.Email)
 
-	t, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	tokens, err := h.issueTokens(c, &user, input.DeviceName)
 	if err != nil {
+		log.Printf("Error issuing tokens for user %d: %v", user.ID, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
 	}
 
-	// Store the token in the database
-	user.Token = t
-	if err := h.DB.Save(&user).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save token"})
+	return c.JSON(tokens)
+}
+
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	var input struct {
+		RefreshToken string `json:"refreshToken"`
 	}
 
-	return c.JSON(fiber.Map{"token": t})
-}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
 
-func (h *AuthHandler) Logout(c *fiber.Ctx) error {
-	userID, err := utils.ExtractUserIDFromToken(c, h.DB)
+	familyID, err := utils.ParseRefreshToken(input.RefreshToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+	}
+
+	var family models.RefreshToken
+	if err := h.DB.Where("family_id = ?", familyID).First(&family).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+	}
+
+	now := time.Now()
+	if !family.IsActive(now) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Refresh token expired or revoked"})
+	}
+
+	presentedHash := utils.HashToken(input.RefreshToken)
+	if subtle.ConstantTimeCompare([]byte(presentedHash), []byte(family.TokenHash)) != 1 {
+		h.revokeSession(family.UserID, family.SessionID, "refresh token reuse detected")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Refresh token reuse detected"})
+	}
+
+	refreshToken, refreshHash, err := utils.NewRefreshToken(family.FamilyID)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
 	}
 
-	// Clear the token in the database
-	result := h.DB.Model(&models.User{}).Where("id = ?", userID).Update("token", "")
+	// Rotate only if nobody else rotated the same token concurrently;
+	// losing that race means the token was presented twice.
+	result := h.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND token_hash = ?", family.ID, presentedHash).
+		Updates(map[string]interface{}{
+			"token_hash":   refreshHash,
+			"last_used_at": now,
+			"expires_at":   now.Add(utils.RefreshTokenTTL),
+		})
 	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to rotate token"})
+	}
+	if result.RowsAffected == 0 {
+		h.revokeSession(family.UserID, family.SessionID, "concurrent refresh token reuse detected")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Refresh token reuse detected"})
+	}
+
+	var session models.AuthSession
+	if err := h.DB.Where("id = ? AND revoked_at IS NULL", family.SessionID).First(&session).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Session revoked"})
+	}
+
+	if err := h.DB.Model(&session).Update("last_seen_at", now).Error; err != nil {
+		log.Printf("Error updating session %d: %v", session.ID, err)
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, family.UserID).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+	}
+
+	accessToken, err := utils.GenerateAccessToken(h.Keys, &user, session.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+
+	return c.JSON(tokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+	})
+}
+
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	if err := h.revokeSessions(user.ID, user.SessionID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to logout"})
 	}
 
 	return c.JSON(fiber.Map{"message": "Logged out successfully"})
 }
+
+func (h *AuthHandler) LogoutAll(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	if err := revokeAllSessions(h.DB, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to logout"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Logged out of all devices"})
+}
+
+func (h *AuthHandler) GetSessions(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	var sessions []models.AuthSession
+	if err := h.DB.Where("user_id = ? AND revoked_at IS NULL", user.ID).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch sessions"})
+	}
+
+	type sessionResponse struct {
+		models.AuthSession
+		Current bool `json:"current"`
+	}
+
+	response := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = sessionResponse{AuthSession: session, Current: session.ID == user.SessionID}
+	}
+
+	return c.JSON(response)
+}
+
+func (h *AuthHandler) DeleteSession(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	sessionID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+	}
+
+	var session models.AuthSession
+	if err := h.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, user.ID).First(&session).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	if err := h.revokeSessions(user.ID, session.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke session"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+// issueTokens opens a new AuthSession for the requesting device and returns
+// its access token and the first refresh token of its family.
+func (h *AuthHandler) issueTokens(c *fiber.Ctx, user *models.User, deviceName string) (*tokenResponse, error) {
+	familyID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := utils.NewRefreshToken(familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.AuthSession{
+		UserID:     user.ID,
+		DeviceName: deviceName,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get(fiber.HeaderUserAgent),
+		LastSeenAt: now,
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.RefreshToken{
+			UserID:    user.ID,
+			SessionID: session.ID,
+			FamilyID:  familyID,
+			TokenHash: refreshHash,
+			ExpiresAt: now.Add(utils.RefreshTokenTTL),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := utils.GenerateAccessToken(h.Keys, user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func (h *AuthHandler) revokeSessions(userID uint, sessionIDs ...uint) error {
+	return revokeSessionsTx(h.DB, userID, sessionIDs...)
+}
+
+// revokeSessionsTx revokes the given sessions of userID together with their
+// refresh token families.
+func revokeSessionsTx(db *gorm.DB, userID uint, sessionIDs ...uint) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.AuthSession{}).
+			Where("user_id = ? AND id IN ? AND revoked_at IS NULL", userID, sessionIDs).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND session_id IN ? AND revoked_at IS NULL", userID, sessionIDs).
+			Update("revoked_at", now).Error
+	})
+}
+
+func (h *AuthHandler) revokeSession(userID, sessionID uint, reason string) {
+	log.Printf("Revoking session %d for user %d: %s", sessionID, userID, reason)
+	if err := h.revokeSessions(userID, sessionID); err != nil {
+		log.Printf("Error revoking session %d: %v", sessionID, err)
+	}
+}
+
+// isDuplicateEmail reports whether err is a violation of the unique index on
+// users.email.
+func isDuplicateEmail(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == models.UserEmailConstraint
+}
+
+// revokeAllSessions logs userID out everywhere: every session and refresh
+// token is revoked, the token version bump rejects any access token still
+// in circulation and the calendar feed URL stops working.
+func revokeAllSessions(db *gorm.DB, userID uint) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.AuthSession{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.CalendarFeed{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+}
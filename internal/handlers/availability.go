@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
+	"github.com/OPTIC7409/tutor-api/internal/scheduling"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAvailabilityRange = 7 * 24 * time.Hour
+	maxAvailabilityRange     = 31 * 24 * time.Hour
+	defaultSlotLength        = time.Hour
+	slotStep                 = 30 * time.Minute
+)
+
+type availabilityWindow struct {
+	Weekday int    `json:"weekday"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+}
+
+// GetAvailability returns the bookable slots of a tutor between from and to:
+// the weekly windows plus extra availability, minus blackouts and sessions
+// that are held, requested or confirmed. Windows are in the tutor's time
+// zone; dates and slots are in the caller's.
+func (h *TutorHandler) GetAvailability(c *fiber.Ctx) error {
+	var tutor models.Tutor
+	if err := h.DB.First(&tutor, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tutor not found"})
+	}
+
+	loc, err := scheduling.LoadLocation(tutor.TimeZone)
+	if err != nil {
+		log.Printf("Tutor %d has an invalid time zone %q", tutor.ID, tutor.TimeZone)
+		loc = time.UTC
+	}
+
+	viewer := middleware.CurrentUser(c).Location()
+	now := time.Now()
+	from, to, length, msg := parseAvailabilityQuery(c, "from", "to", viewer, now)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	var windows []models.AvailabilityWindow
+	if err := h.DB.Where("tutor_id = ?", tutor.ID).Order("weekday, start_minute").Find(&windows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch availability"})
+	}
+	free, err := tutorFreeTime(h.DB, []models.Tutor{tutor}, from, to, now)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch availability"})
+	}
+
+	slots := scheduling.Slots(free[tutor.ID], length, slotStep)
+	for i := range slots {
+		slots[i].Start = slots[i].Start.In(viewer)
+		slots[i].End = slots[i].End.In(viewer)
+	}
+
+	return c.JSON(fiber.Map{
+		"timeZone":       loc.String(),
+		"windows":        toAvailabilityWindows(windows),
+		"viewerTimeZone": viewer.String(),
+		"slots":          slots,
+	})
+}
+
+// parseAvailabilityQuery reads a range of time and a slot length from the
+// query string, returning an error message if they are invalid. The range
+// starts no earlier than now, since slots in the past cannot be booked.
+func parseAvailabilityQuery(c *fiber.Ctx, fromKey, toKey string, viewer *time.Location, now time.Time) (time.Time, time.Time, time.Duration, string) {
+	from, err := parseAvailabilityTime(c.Query(fromKey), viewer, now)
+	if err != nil {
+		return from, from, 0, fromKey + " must be an RFC 3339 timestamp or a date"
+	}
+	to, err := parseAvailabilityTime(c.Query(toKey), viewer, from.Add(defaultAvailabilityRange))
+	if err != nil {
+		return from, to, 0, toKey + " must be an RFC 3339 timestamp or a date"
+	}
+	if !to.After(from) || to.Sub(from) > maxAvailabilityRange {
+		return from, to, 0, toKey + " must be after " + fromKey + " and at most 31 days later"
+	}
+
+	length := defaultSlotLength
+	if d := c.Query("duration"); d != "" {
+		minutes, err := strconv.Atoi(d)
+		length = time.Duration(minutes) * time.Minute
+		if err != nil || length < minSessionLength || length > maxSessionLength {
+			return from, to, 0, "duration must be between 15 and 480 minutes"
+		}
+	}
+
+	if from.Before(now) {
+		from = now
+	}
+	return from, to, length, ""
+}
+
+// tutorFreeTime returns the free time of each tutor between from and to,
+// keyed by tutor ID: their weekly windows plus extra availability, minus
+// blackouts and sessions that are held, requested or confirmed.
+func tutorFreeTime(db *gorm.DB, tutors []models.Tutor, from, to, now time.Time) (map[uint][]scheduling.Interval, error) {
+	tutorIDs := make([]uint, len(tutors))
+	userIDs := make([]uint, len(tutors))
+	for i, t := range tutors {
+		tutorIDs[i], userIDs[i] = t.ID, t.UserID
+	}
+
+	var windows []models.AvailabilityWindow
+	var exceptions []models.AvailabilityException
+	var sessions []models.Session
+	if err := db.Where("tutor_id IN ?", tutorIDs).Find(&windows).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("tutor_id IN ? AND start_time < ? AND end_time > ?", tutorIDs, to, from).Find(&exceptions).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("tutor_id IN ? AND status IN ? AND (hold_expires_at IS NULL OR hold_expires_at > ?) AND start_time < ? AND end_time > ?",
+		userIDs, models.ActiveSessionStatuses, now, to, from).
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	weekly := make(map[uint][]scheduling.Window)
+	for _, w := range windows {
+		weekly[w.TutorID] = append(weekly[w.TutorID], scheduling.Window{Weekday: time.Weekday(w.Weekday), Start: w.StartMinute, End: w.EndMinute})
+	}
+	extra := make(map[uint][]scheduling.Interval)
+	busy := make(map[uint][]scheduling.Interval)
+	for _, e := range exceptions {
+		interval := scheduling.Interval{Start: e.StartTime, End: e.EndTime}
+		if e.Available {
+			extra[e.TutorID] = append(extra[e.TutorID], interval)
+		} else {
+			busy[e.TutorID] = append(busy[e.TutorID], interval)
+		}
+	}
+	booked := make(map[uint][]scheduling.Interval)
+	for _, s := range sessions {
+		booked[s.TutorID] = append(booked[s.TutorID], scheduling.Interval{Start: s.StartTime, End: s.EndTime})
+	}
+
+	free := make(map[uint][]scheduling.Interval, len(tutors))
+	for _, t := range tutors {
+		loc, err := scheduling.LoadLocation(t.TimeZone)
+		if err != nil {
+			log.Printf("Tutor %d has an invalid time zone %q", t.ID, t.TimeZone)
+			loc = time.UTC
+		}
+
+		// Extra availability may reach outside the requested range
+		open := append(scheduling.Expand(weekly[t.ID], loc, from, to), extra[t.ID]...)
+		free[t.ID] = scheduling.Subtract(scheduling.Clip(open, from, to), append(busy[t.ID], booked[t.UserID]...))
+	}
+	return free, nil
+}
+
+// SetAvailability replaces a tutor's weekly windows and optionally their
+// time zone.
+func (h *TutorHandler) SetAvailability(c *fiber.Ctx) error {
+	var input struct {
+		TimeZone string               `json:"timeZone"`
+		Windows  []availabilityWindow `json:"windows"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	tutor, err := h.findOwnTutor(c)
+	if tutor == nil {
+		return err
+	}
+
+	if input.TimeZone != "" {
+		if _, err := scheduling.LoadLocation(input.TimeZone); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown time zone " + strconv.Quote(input.TimeZone)})
+		}
+		tutor.TimeZone = input.TimeZone
+	}
+
+	windows := make([]models.AvailabilityWindow, len(input.Windows))
+	for i, w := range input.Windows {
+		start, err := scheduling.ParseClock(w.Start)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		end, err := scheduling.ParseClock(w.End)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if w.Weekday < 0 || w.Weekday > 6 || start >= end {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Each window needs a weekday from 0 (Sunday) to 6 and a start before its end"})
+		}
+		windows[i] = models.AvailabilityWindow{TutorID: tutor.ID, Weekday: w.Weekday, StartMinute: start, EndMinute: end}
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(tutor).Update("time_zone", tutor.TimeZone).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tutor_id = ?", tutor.ID).Delete(&models.AvailabilityWindow{}).Error; err != nil {
+			return err
+		}
+		if len(windows) == 0 {
+			return nil
+		}
+		return tx.Create(&windows).Error
+	})
+	if err != nil {
+		log.Printf("Error saving availability for tutor %d: %v", tutor.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save availability"})
+	}
+
+	return c.JSON(fiber.Map{"timeZone": tutor.TimeZone, "windows": toAvailabilityWindows(windows)})
+}
+
+func (h *TutorHandler) GetAvailabilityExceptions(c *fiber.Ctx) error {
+	tutor, err := h.findOwnTutor(c)
+	if tutor == nil {
+		return err
+	}
+
+	var exceptions []models.AvailabilityException
+	if err := h.DB.Where("tutor_id = ? AND end_time > ?", tutor.ID, time.Now()).Order("start_time").Find(&exceptions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch exceptions"})
+	}
+
+	loc := middleware.CurrentUser(c).Location()
+	for i := range exceptions {
+		exceptions[i].Localize(loc)
+	}
+	return c.JSON(exceptions)
+}
+
+// CreateAvailabilityException adds a one-off blackout, or extra
+// availability when available is set.
+func (h *TutorHandler) CreateAvailabilityException(c *fiber.Ctx) error {
+	var exception models.AvailabilityException
+	if err := c.BodyParser(&exception); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	tutor, err := h.findOwnTutor(c)
+	if tutor == nil {
+		return err
+	}
+
+	if exception.StartTime.IsZero() || !exception.EndTime.After(exception.StartTime) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "startTime must be before endTime"})
+	}
+
+	exception.ID = 0
+	exception.TutorID = tutor.ID
+	if err := h.DB.Create(&exception).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create exception"})
+	}
+
+	exception.Localize(middleware.CurrentUser(c).Location())
+	return c.Status(fiber.StatusCreated).JSON(exception)
+}
+
+func (h *TutorHandler) DeleteAvailabilityException(c *fiber.Ctx) error {
+	tutor, err := h.findOwnTutor(c)
+	if tutor == nil {
+		return err
+	}
+
+	result := h.DB.Where("id = ? AND tutor_id = ?", c.Params("exceptionId"), tutor.ID).Delete(&models.AvailabilityException{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete exception"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Exception not found"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// findOwnTutor loads the tutor named in the route if the caller owns the
+// profile or is an admin. Otherwise it writes the error response and
+// returns a nil tutor.
+func (h *TutorHandler) findOwnTutor(c *fiber.Ctx) (*models.Tutor, error) {
+	var tutor models.Tutor
+	if err := h.DB.First(&tutor, c.Params("id")).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tutor not found"})
+	}
+
+	if !policy.IsOwnerOrAdmin(middleware.CurrentUser(c), tutor.UserID) {
+		return nil, policy.Forbidden(c)
+	}
+
+	return &tutor, nil
+}
+
+// parseAvailabilityTime accepts an RFC 3339 timestamp or a date, which is
+// read as midnight in loc.
+func parseAvailabilityTime(value string, loc *time.Location, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
+
+func toAvailabilityWindows(windows []models.AvailabilityWindow) []availabilityWindow {
+	result := make([]availabilityWindow, len(windows))
+	for i, w := range windows {
+		result[i] = availabilityWindow{
+			Weekday: w.Weekday,
+			Start:   scheduling.FormatClock(w.StartMinute),
+			End:     scheduling.FormatClock(w.EndMinute),
+		}
+	}
+	return result
+}
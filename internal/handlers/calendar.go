@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/ical"
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/scheduling"
+	"github.com/OPTIC7409/tutor-api/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// calendarFeedHistory is how far back a calendar feed lists sessions.
+const calendarFeedHistory = 90 * 24 * time.Hour
+
+type CalendarHandler struct {
+	DB *gorm.DB
+}
+
+func NewCalendarHandler(db *gorm.DB) *CalendarHandler {
+	return &CalendarHandler{DB: db}
+}
+
+// CreateFeed issues the caller a secret calendar subscription URL. Any URL
+// issued before stops working.
+func (h *CalendarHandler) CreateFeed(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create calendar feed"})
+	}
+
+	feed := models.CalendarFeed{UserID: user.ID, TokenHash: utils.HashToken(token)}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.CalendarFeed{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&feed).Error
+	})
+	if err != nil {
+		log.Printf("Error creating calendar feed for user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create calendar feed"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"url":  fmt.Sprintf("%s/api/calendar/%s.ics", c.BaseURL(), token),
+		"feed": feed,
+	})
+}
+
+func (h *CalendarHandler) DeleteFeed(c *fiber.Ctx) error {
+	result := h.DB.Where("user_id = ?", middleware.CurrentUser(c).ID).Delete(&models.CalendarFeed{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete calendar feed"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Calendar feed not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Calendar feed deleted"})
+}
+
+// GetFeed serves the sessions of the feed's owner as an iCalendar file.
+// Calendar apps cannot send credentials, so the token in the URL is the
+// only authentication.
+func (h *CalendarHandler) GetFeed(c *fiber.Ctx) error {
+	var feed models.CalendarFeed
+	if err := h.DB.Where("token_hash = ?", utils.HashToken(c.Params("token"))).First(&feed).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Calendar feed not found"})
+	}
+
+	var owner models.User
+	if err := h.DB.First(&owner, feed.UserID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Calendar feed not found"})
+	}
+
+	now := time.Now()
+	var sessions []models.Session
+	if err := h.DB.Preload("Tutor").Preload("Student").
+		Where("(tutor_id = ? OR student_id = ?) AND status IN ? AND end_time > ?", owner.ID, owner.ID,
+			[]string{models.SessionRequested, models.SessionConfirmed, models.SessionCompleted, models.SessionCancelled},
+			now.Add(-calendarFeedHistory)).
+		Order("start_time").Find(&sessions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch sessions"})
+	}
+
+	events := sessionEvents(sessions, owner.ID, scheduling.LocationOrUTC(owner.TimeZone))
+
+	if err := h.DB.Model(&feed).Update("last_used_at", now).Error; err != nil {
+		log.Printf("Error recording use of calendar feed %d: %v", feed.ID, err)
+	}
+
+	calendar := ical.Calendar{Name: "Tutoring sessions", Events: events}
+	return sendCalendar(c, &calendar, "")
+}
+
+// ExportSession downloads a single session as an iCalendar file.
+func (h *SessionHandler) ExportSession(c *fiber.Ctx) error {
+	session, err := h.findSession(c)
+	if session == nil {
+		return err
+	}
+
+	user := middleware.CurrentUser(c)
+	events := sessionEvents([]models.Session{*session}, user.ID, user.Location())
+
+	calendar := ical.Calendar{Events: events}
+	return sendCalendar(c, &calendar, fmt.Sprintf("session-%d.ics", session.ID))
+}
+
+// sessionEvents converts sessions, with Tutor and Student loaded, into
+// calendar events as seen by viewerID in loc. Events keep the session's UID
+// however often it is rescheduled.
+func sessionEvents(sessions []models.Session, viewerID uint, loc *time.Location) []ical.Event {
+	events := make([]ical.Event, len(sessions))
+	for i, s := range sessions {
+		other := s.Tutor.Name
+		if s.TutorID == viewerID {
+			other = s.Student.Name
+		}
+
+		description := "Status: " + s.Status
+		if s.CancellationReason != "" {
+			description += "\nReason: " + s.CancellationReason
+		}
+
+		events[i] = ical.Event{
+			UID:          fmt.Sprintf("session-%d@tutor-api", s.ID),
+			Sequence:     s.Sequence,
+			Summary:      fmt.Sprintf("%s with %s", s.Subject, other),
+			Description:  description,
+			Status:       calendarStatus(s.Status),
+			Start:        s.StartTime,
+			End:          s.EndTime,
+			Location:     loc,
+			Created:      s.CreatedAt,
+			LastModified: s.UpdatedAt,
+		}
+	}
+	return events
+}
+
+func calendarStatus(status string) string {
+	switch status {
+	case models.SessionConfirmed, models.SessionCompleted:
+		return ical.StatusConfirmed
+	case models.SessionCancelled, models.SessionExpired:
+		return ical.StatusCancelled
+	}
+	return ical.StatusTentative
+}
+
+// sendCalendar writes calendar as the response, as a download named
+// filename when one is given.
+func sendCalendar(c *fiber.Ctx, calendar *ical.Calendar, filename string) error {
+	if filename != "" {
+		c.Attachment(filename)
+	}
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	return c.Send(calendar.Marshal(time.Now()))
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
 	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
@@ -15,8 +17,13 @@ func NewChatHandler(db *gorm.DB) *ChatHandler {
 }
 
 func (h *ChatHandler) GetChats(c *fiber.Ctx) error {
+	userID := middleware.CurrentUser(c).ID
+
 	var chats []models.Chat
-	if err := h.DB.Preload("Participants").Find(&chats).Error; err != nil {
+	if err := h.DB.Preload("Participants").
+		Joins("JOIN chat_participants ON chat_participants.chat_id = chats.id").
+		Where("chat_participants.user_id = ?", userID).
+		Find(&chats).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch chats",
 		})
@@ -32,6 +39,12 @@ func (h *ChatHandler) GetChat(c *fiber.Ctx) error {
 			"error": "Chat not found",
 		})
 	}
+
+	user := middleware.CurrentUser(c)
+	if !isParticipant(chat.Participants, user.ID) && !policy.IsAdmin(user) {
+		return policy.Forbidden(c)
+	}
+
 	return c.JSON(chat)
 }
 
@@ -45,6 +58,9 @@ func (h *ChatHandler) CreateChat(c *fiber.Ctx) error {
 		})
 	}
 
+	userID := middleware.CurrentUser(c).ID
+	input.Participants = appendUnique(input.Participants, userID)
+
 	if len(input.Participants) < 2 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "At least two participants are required",
@@ -80,8 +96,7 @@ func (h *ChatHandler) CreateChat(c *fiber.Ctx) error {
 func (h *ChatHandler) SendMessage(c *fiber.Ctx) error {
 	chatID := c.Params("id")
 	var input struct {
-		SenderID uint   `json:"senderID"`
-		Content  string `json:"content"`
+		Content string `json:"content"`
 	}
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -90,15 +105,19 @@ func (h *ChatHandler) SendMessage(c *fiber.Ctx) error {
 	}
 
 	var chat models.Chat
-	if err := h.DB.First(&chat, chatID).Error; err != nil {
+	if err := h.DB.Preload("Participants").First(&chat, chatID).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Chat not found",
 		})
 	}
 
+	if !isParticipant(chat.Participants, middleware.CurrentUser(c).ID) {
+		return policy.Forbidden(c)
+	}
+
 	message := models.Message{
 		ChatID:   chat.ID,
-		SenderID: input.SenderID,
+		SenderID: middleware.CurrentUser(c).ID,
 		Content:  input.Content,
 	}
 
@@ -110,3 +129,21 @@ func (h *ChatHandler) SendMessage(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusCreated).JSON(message)
 }
+
+func appendUnique(ids []uint, id uint) []uint {
+	for _, existing := range ids {
+		if existing == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+func isParticipant(participants []models.User, userID uint) bool {
+	for _, participant := range participants {
+		if participant.ID == userID {
+			return true
+		}
+	}
+	return false
+}
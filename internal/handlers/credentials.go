@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
+	var input struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	input.NewPassword = strings.TrimSpace(input.NewPassword)
+	if len(input.NewPassword) < minPasswordLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Password must be at least %d characters", minPasswordLength)})
+	}
+
+	current := middleware.CurrentUser(c)
+	var user models.User
+	if err := h.DB.First(&user, current.ID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if err := user.ComparePassword(strings.TrimSpace(input.CurrentPassword)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Current password is incorrect"})
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// The User model's BeforeSave hook hashes the new password
+		user.Password = input.NewPassword
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+
+		return revokeOtherSessions(tx, user.ID, current.SessionID)
+	})
+	if err != nil {
+		log.Printf("Error changing password for user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to change password"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Password changed successfully"})
+}
+
+// ChangeEmail records the new address as pending and mails it a
+// verification link; the account's email only changes once that link is
+// used.
+func (h *AuthHandler) ChangeEmail(c *fiber.Ctx) error {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	input.Email = strings.TrimSpace(input.Email)
+	if !strings.Contains(input.Email, "@") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid email address"})
+	}
+
+	current := middleware.CurrentUser(c)
+	var user models.User
+	if err := h.DB.First(&user, current.ID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if err := user.ComparePassword(strings.TrimSpace(input.Password)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Password is incorrect"})
+	}
+
+	if strings.EqualFold(input.Email, user.Email) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "This is already your email address"})
+	}
+
+	var count int64
+	if err := h.DB.Model(&models.User{}).Where("email = ?", input.Email).Count(&count).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to change email"})
+	}
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Email already exists"})
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("pending_email", input.Email).Error; err != nil {
+			return err
+		}
+
+		return revokeOtherSessions(tx, user.ID, current.SessionID)
+	})
+	if err != nil {
+		log.Printf("Error changing email for user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to change email"})
+	}
+
+	if err := h.sendVerificationEmail(&user, input.Email); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to send verification email"})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Check your new email address to confirm the change"})
+}
+
+// revokeOtherSessions revokes every session of userID except keepSessionID,
+// used when credentials change from a device the user is signed in on.
+func revokeOtherSessions(db *gorm.DB, userID, keepSessionID uint) error {
+	var sessionIDs []uint
+	if err := db.Model(&models.AuthSession{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepSessionID).
+		Pluck("id", &sessionIDs).Error; err != nil {
+		return err
+	}
+
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+
+	return revokeSessionsTx(db, userID, sessionIDs...)
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/mailer"
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+
+	// Resending is limited to one email per cooldown and a handful per day
+	verificationResendCooldown = time.Minute
+	verificationResendWindow   = 24 * time.Hour
+	verificationResendMax      = 5
+)
+
+var (
+	errVerificationTokenInvalid = errors.New("verification token is invalid or has expired")
+	errEmailTaken               = errors.New("email already exists")
+)
+
+func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	now := time.Now()
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var verification models.EmailVerificationToken
+		if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(input.Token), now).
+			First(&verification).Error; err != nil {
+			return errVerificationTokenInvalid
+		}
+
+		result := tx.Model(&verification).Where("used_at IS NULL").Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVerificationTokenInvalid
+		}
+
+		var user models.User
+		if err := tx.First(&user, verification.UserID).Error; err != nil {
+			return errVerificationTokenInvalid
+		}
+
+		// The token only verifies the address it was sent to: either the
+		// current email or the one the user asked to change to.
+		switch verification.Email {
+		case user.Email:
+			return tx.Model(&user).Update("email_verified_at", now).Error
+		case user.PendingEmail:
+			// Another account may have claimed the address since the change
+			// was requested
+			err := tx.Model(&user).Updates(map[string]interface{}{
+				"email":             user.PendingEmail,
+				"pending_email":     "",
+				"email_verified_at": now,
+			}).Error
+			if err != nil && isDuplicateEmail(err) {
+				return errEmailTaken
+			}
+			return err
+		default:
+			return errVerificationTokenInvalid
+		}
+	})
+	if errors.Is(err, errVerificationTokenInvalid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Verification token is invalid or has expired"})
+	}
+	if errors.Is(err, errEmailTaken) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Email already exists"})
+	}
+	if err != nil {
+		log.Printf("Error verifying email: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify email"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Email verified successfully"})
+}
+
+func (h *AuthHandler) ResendVerification(c *fiber.Ctx) error {
+	var user models.User
+	if err := h.DB.First(&user, middleware.CurrentUser(c).ID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if user.IsEmailVerified() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Email is already verified"})
+	}
+
+	now := time.Now()
+	var recent []models.EmailVerificationToken
+	if err := h.DB.Where("user_id = ? AND created_at > ?", user.ID, now.Add(-verificationResendWindow)).
+		Order("created_at DESC").
+		Find(&recent).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resend verification email"})
+	}
+
+	var retryAfter time.Duration
+	if len(recent) >= verificationResendMax {
+		retryAfter = recent[verificationResendMax-1].CreatedAt.Add(verificationResendWindow).Sub(now)
+	} else if len(recent) > 0 {
+		retryAfter = recent[0].CreatedAt.Add(verificationResendCooldown).Sub(now)
+	}
+	if retryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(retryAfter.Seconds())+1))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Too many verification emails requested, please try again later"})
+	}
+
+	if err := h.sendVerificationEmail(&user, user.Email); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to resend verification email"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Verification email sent"})
+}
+
+// sendVerificationEmail mails user a link proving they own email.
+func (h *AuthHandler) sendVerificationEmail(user *models.User, email string) error {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = h.DB.Create(&models.EmailVerificationToken{
+		UserID:    user.ID,
+		Email:     email,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", h.Config.AppURL, url.QueryEscape(token))
+	return h.Mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below "+
+			"within the next 24 hours:\n\n%s", user.Name, link),
+	})
+}
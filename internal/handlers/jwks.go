@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// JWKS publishes the public keys access tokens are signed with so other
+// services can verify them.
+func (h *AuthHandler) JWKS(c *fiber.Ctx) error {
+	set, err := h.Keys.JWKS()
+	if err != nil {
+		log.Printf("Error encoding signing keys: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load signing keys"})
+	}
+
+	// Keys are published ahead of use, so verifiers may cache them briefly
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(set)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/geocode"
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	geocodeTimeout      = 5 * time.Second
+	maxTravelRadiusKm   = 200
+	defaultNearRadiusKm = 25
+	maxNearRadiusKm     = 500
+	earthRadiusKm       = 6371.0
+	kmPerDegree         = earthRadiusKm * math.Pi / 180
+)
+
+// geolocate geocodes a profile's location. Places the geocoder can't find,
+// such as "Online", and geocoder failures leave the profile without
+// coordinates rather than failing the request.
+func geolocate(c *fiber.Ctx, geocoder geocode.Geocoder, location string) (lat, lng *float64) {
+	if strings.TrimSpace(location) == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), geocodeTimeout)
+	defer cancel()
+	point, err := geocoder.Geocode(ctx, location)
+	if err != nil {
+		if !errors.Is(err, geocode.ErrNotFound) {
+			log.Printf("Error geocoding %q: %v", location, err)
+		}
+		return nil, nil
+	}
+	return &point.Lat, &point.Lng
+}
+
+// parseNear reads near, either "lat,lng" or "me" for the caller's student
+// profile, and radius_km. It returns an error message if they are invalid.
+func parseNear(c *fiber.Ctx, db *gorm.DB) (geocode.Point, float64, string) {
+	var point geocode.Point
+	if near := c.Query("near"); near == "me" {
+		var student models.Student
+		err := db.Where("user_id = ? AND latitude IS NOT NULL AND longitude IS NOT NULL", middleware.CurrentUser(c).ID).First(&student).Error
+		if err != nil {
+			return point, 0, "near=me needs a student profile with a known location"
+		}
+		point = geocode.Point{Lat: *student.Latitude, Lng: *student.Longitude}
+	} else {
+		lat, lng, ok := strings.Cut(near, ",")
+		var latErr, lngErr error
+		if ok {
+			point.Lat, latErr = strconv.ParseFloat(strings.TrimSpace(lat), 64)
+			point.Lng, lngErr = strconv.ParseFloat(strings.TrimSpace(lng), 64)
+		}
+		if !ok || latErr != nil || lngErr != nil || math.Abs(point.Lat) > 90 || math.Abs(point.Lng) > 180 {
+			return point, 0, "near must be lat,lng in decimal degrees, or me"
+		}
+	}
+
+	radius := float64(defaultNearRadiusKm)
+	if s := c.Query("radius_km"); s != "" {
+		var err error
+		radius, err = strconv.ParseFloat(s, 64)
+		if err != nil || radius <= 0 || radius > maxNearRadiusKm {
+			return point, 0, fmt.Sprintf("radius_km must be more than 0 and at most %d", maxNearRadiusKm)
+		}
+	}
+	return point, radius, ""
+}
+
+// nearTutors narrows query to the tutors who teach in person within radius
+// km of point, or whose travel radius reaches it, and adds their distance
+// from point in km as distance_km.
+func nearTutors(db, query *gorm.DB, point geocode.Point, radius float64) *gorm.DB {
+	// No tutor travels further than maxTravelRadiusKm, so the box around the
+	// point that could hold a match is small enough for the coordinates index
+	latDelta := math.Max(radius, maxTravelRadiusKm) / kmPerDegree
+	query = query.Where("tutors.lesson_mode <> ?", models.LessonModeOnline).
+		Where("tutors.latitude BETWEEN ? AND ?", point.Lat-latDelta, point.Lat+latDelta)
+	if cos := math.Cos(point.Lat * math.Pi / 180); cos > 0.01 {
+		// Boxes across the antimeridian would need two ranges; those are rare
+		// enough to check by distance alone
+		lngDelta := latDelta / cos
+		if point.Lng-lngDelta >= -180 && point.Lng+lngDelta <= 180 {
+			query = query.Where("tutors.longitude BETWEEN ? AND ?", point.Lng-lngDelta, point.Lng+lngDelta)
+		}
+	}
+
+	// Haversine distance, rounded so that cursors can resume on it exactly
+	located := query.Select(`tutors.*, round((2 * ?::float8 * asin(least(1, sqrt(
+		power(sin(radians(tutors.latitude - ?) / 2), 2) +
+		cos(radians(?)) * cos(radians(tutors.latitude)) * power(sin(radians(tutors.longitude - ?) / 2), 2)
+	))))::numeric, 2)::float8 AS distance_km`, earthRadiusKm, point.Lat, point.Lat, point.Lng)
+
+	return db.Model(&models.Tutor{}).Table("(?) AS tutors", located).
+		Where("tutors.distance_km <= greatest(?, tutors.travel_radius_km)", radius)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/loginguard"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// loginThrottled answers the request when the account or the client IP has
+// to wait before trying again. Counters are keyed by the submitted email so
+// unknown addresses are throttled exactly like real ones.
+func (h *AuthHandler) loginThrottled(c *fiber.Ctx, email string) (bool, error) {
+	ctx := c.Context()
+
+	wait, locked, err := h.Limiter.Accounts.Check(ctx, loginguard.AccountKey(email))
+	if err != nil {
+		log.Printf("Error checking login attempts: %v", err)
+		return false, nil
+	}
+	if wait == 0 {
+		wait, _, err = h.Limiter.IPs.Check(ctx, loginguard.IPKey(c.IP()))
+		if err != nil {
+			log.Printf("Error checking login attempts: %v", err)
+			return false, nil
+		}
+	}
+	if wait == 0 {
+		return false, nil
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait/time.Second)+1))
+	if locked {
+		return true, c.Status(fiber.StatusLocked).JSON(fiber.Map{"error": "Account is temporarily locked due to too many failed login attempts"})
+	}
+	return true, c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Too many failed login attempts, please try again later"})
+}
+
+// loginFailed counts a failed attempt and audits the lockout it may cause.
+// user is nil when the email does not belong to an account.
+func (h *AuthHandler) loginFailed(c *fiber.Ctx, email string, user *models.User) {
+	ctx := c.Context()
+
+	if _, err := h.Limiter.IPs.Fail(ctx, loginguard.IPKey(c.IP())); err != nil {
+		log.Printf("Error recording failed login: %v", err)
+	}
+
+	locked, err := h.Limiter.Accounts.Fail(ctx, loginguard.AccountKey(email))
+	if err != nil {
+		log.Printf("Error recording failed login: %v", err)
+		return
+	}
+	if !locked {
+		return
+	}
+
+	entry := models.AuditLog{
+		Action:    models.AuditAccountLocked,
+		IPAddress: c.IP(),
+		Details:   fmt.Sprintf("Locked for %s after %d failed login attempts", loginguard.AccountPolicy.LockoutDuration, loginguard.AccountPolicy.LockoutThreshold),
+	}
+	if user != nil {
+		entry.UserID = &user.ID
+	} else {
+		// The email is attacker supplied, so only a short digest of it is
+		// stored: a prefix of the digest of its loginguard.AccountKey.
+		entry.Details += " for unknown email sha256:" + utils.HashToken(loginguard.AccountKey(email))[:16]
+	}
+	recordAudit(h.DB, entry)
+}
+
+func (h *AuthHandler) loginSucceeded(c *fiber.Ctx, email string) {
+	if err := h.Limiter.Accounts.Succeed(c.Context(), loginguard.AccountKey(email)); err != nil {
+		log.Printf("Error resetting login attempts: %v", err)
+	}
+}
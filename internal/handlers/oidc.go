@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/oidc"
+	"github.com/OPTIC7409/tutor-api/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	errOIDCEmailNotVerified   = errors.New("provider did not verify the email address")
+	errOIDCAccountNotVerified = errors.New("account with the email address is not verified")
+)
+
+// OIDCLogin redirects the browser to the provider's authorization endpoint.
+func (h *AuthHandler) OIDCLogin(c *fiber.Ctx) error {
+	provider, ok := h.OIDCProviders[c.Params("provider")]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown login provider"})
+	}
+
+	state, err := oidc.NewState()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start login"})
+	}
+	nonce, err := oidc.NewState()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start login"})
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start login"})
+	}
+
+	now := time.Now()
+	h.DB.Where("expires_at < ?", now).Delete(&models.OIDCLoginState{})
+
+	err = h.DB.Create(&models.OIDCLoginState{
+		StateHash:    utils.HashToken(state),
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(oidcStateTTL),
+	}).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start login"})
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Context(), state, nonce, challenge)
+	if err != nil {
+		log.Printf("Error contacting OIDC provider %s: %v", provider.Name, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "Login provider is unavailable"})
+	}
+
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// OIDCCallback completes the authorization code flow and issues the same
+// tokens as a password login.
+func (h *AuthHandler) OIDCCallback(c *fiber.Ctx) error {
+	provider, ok := h.OIDCProviders[c.Params("provider")]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown login provider"})
+	}
+
+	if errorCode := c.Query("error"); errorCode != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Login was not completed: " + errorCode})
+	}
+
+	var state models.OIDCLoginState
+	err := h.DB.Where("state_hash = ? AND provider = ? AND expires_at > ?", utils.HashToken(c.Query("state")), provider.Name, time.Now()).
+		First(&state).Error
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Login session is invalid or has expired"})
+	}
+
+	// Each state can complete exactly one login
+	result := h.DB.Delete(&state)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Login session is invalid or has expired"})
+	}
+
+	tokens, err := provider.Exchange(c.Context(), c.Query("code"), state.CodeVerifier)
+	if err != nil {
+		log.Printf("Error exchanging OIDC code with %s: %v", provider.Name, err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Login failed"})
+	}
+
+	claims, err := provider.VerifyIDToken(c.Context(), tokens.IDToken, state.Nonce)
+	if err != nil {
+		log.Printf("Error verifying OIDC id_token from %s: %v", provider.Name, err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Login failed"})
+	}
+
+	user, err := h.userForIdentity(provider.Name, claims)
+	if errors.Is(err, errOIDCEmailNotVerified) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Your email address is not verified with this provider"})
+	}
+	if errors.Is(err, errOIDCAccountNotVerified) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "An account with this email address exists but is not verified. Verify it before signing in with this provider"})
+	}
+	if err != nil {
+		log.Printf("Error linking OIDC identity from %s: %v", provider.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Login failed"})
+	}
+
+	if user.TOTPEnabled {
+		return h.mfaChallenge(c, user)
+	}
+
+	response, err := h.issueTokens(c, user, "")
+	if err != nil {
+		log.Printf("Error issuing tokens for user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+
+	return c.JSON(response)
+}
+
+// userForIdentity returns the user linked to the provider account, linking
+// it by verified email to an existing user or a new student account on the
+// first login. Unverified accounts are never linked: whoever registered
+// them, and knows their password, may not own the email address.
+func (h *AuthHandler) userForIdentity(provider string, claims *oidc.IDTokenClaims) (*models.User, error) {
+	var user models.User
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.ExternalIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+		if err == nil {
+			return tx.First(&user, identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		email := strings.TrimSpace(claims.Email)
+		if email == "" || !claims.IsEmailVerified() {
+			return errOIDCEmailNotVerified
+		}
+
+		now := time.Now()
+		err = tx.Where("email = ?", email).First(&user).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// Password logins stay impossible until the user resets it
+			password, err := utils.GenerateRandomToken(32)
+			if err != nil {
+				return err
+			}
+
+			name := claims.Name
+			if name == "" {
+				name = email
+			}
+
+			user = models.User{
+				Name:            name,
+				Email:           email,
+				Password:        password,
+				UserType:        models.UserTypeStudent,
+				EmailVerifiedAt: &now,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case !user.IsEmailVerified():
+			return errOIDCAccountNotVerified
+		}
+
+		return tx.Create(&models.ExternalIdentity{
+			UserID:   user.ID,
+			Provider: provider,
+			Subject:  claims.Subject,
+			Email:    email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
+	"github.com/OPTIC7409/tutor-api/internal/scope"
+	"github.com/OPTIC7409/tutor-api/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type OrganisationHandler struct {
+	DB *gorm.DB
+}
+
+func NewOrganisationHandler(db *gorm.DB) *OrganisationHandler {
+	return &OrganisationHandler{DB: db}
+}
+
+func (h *OrganisationHandler) CreateOrganisation(c *fiber.Ctx) error {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	organisation := models.Organisation{Name: strings.TrimSpace(input.Name)}
+	if organisation.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name is required"})
+	}
+
+	if err := h.DB.Create(&organisation).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create organisation"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(organisation)
+}
+
+func (h *OrganisationHandler) GetOrganisation(c *fiber.Ctx) error {
+	organisation, err := h.findOrganisation(c)
+	if organisation == nil {
+		return err
+	}
+
+	var members []organisationMember
+	if err := h.DB.Model(&models.User{}).Select("id, name, organisation_role AS role").
+		Where("organisation_id = ?", organisation.ID).Order("id").Find(&members).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch organisation"})
+	}
+
+	return c.JSON(fiber.Map{"organisation": organisation, "members": members})
+}
+
+// organisationMember is a member as other members see them.
+type organisationMember struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// AddMember adds a user to the organisation as a member or, with role
+// admin, as someone who manages its API keys. Adding an existing member
+// again changes their role.
+func (h *OrganisationHandler) AddMember(c *fiber.Ctx) error {
+	var input struct {
+		UserID uint   `json:"userId"`
+		Role   string `json:"role"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if input.Role == "" {
+		input.Role = models.OrganisationRoleMember
+	}
+	if input.Role != models.OrganisationRoleMember && input.Role != models.OrganisationRoleAdmin {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role must be member or admin"})
+	}
+
+	organisation, err := h.findOrganisation(c)
+	if organisation == nil {
+		return err
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, input.UserID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.OrganisationID != nil && *user.OrganisationID != organisation.ID {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User already belongs to another organisation"})
+	}
+
+	if err := h.DB.Model(&user).Updates(map[string]interface{}{"organisation_id": organisation.ID, "organisation_role": input.Role}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add member"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Member added"})
+}
+
+// RemoveMember takes a user out of the organisation. API keys they created
+// stop working immediately.
+func (h *OrganisationHandler) RemoveMember(c *fiber.Ctx) error {
+	organisation, err := h.findOrganisation(c)
+	if organisation == nil {
+		return err
+	}
+
+	result := h.DB.Model(&models.User{}).
+		Where("id = ? AND organisation_id = ?", c.Params("userId"), organisation.ID).
+		Updates(map[string]interface{}{"organisation_id": nil, "organisation_role": ""})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove member"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Member not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Member removed"})
+}
+
+func (h *OrganisationHandler) GetAPIKeys(c *fiber.Ctx) error {
+	organisation, err := h.findOrganisation(c)
+	if organisation == nil {
+		return err
+	}
+	if !managesKeys(middleware.CurrentUser(c), organisation) {
+		return policy.Forbidden(c)
+	}
+
+	var keys []models.APIKey
+	if err := h.DB.Where("organisation_id = ?", organisation.ID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch API keys"})
+	}
+
+	return c.JSON(keys)
+}
+
+// CreateAPIKey issues a key acting on behalf of the calling member. The key
+// itself is only ever returned in this response.
+func (h *OrganisationHandler) CreateAPIKey(c *fiber.Ctx) error {
+	var input struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	organisation, err := h.findOrganisation(c)
+	if organisation == nil {
+		return err
+	}
+
+	// Keys act for their creator, so only the organisation's own admins can
+	// create them
+	user := middleware.CurrentUser(c)
+	if user.OrganisationID != organisation.ID || user.OrganisationRole != models.OrganisationRoleAdmin {
+		return policy.Forbidden(c)
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name is required"})
+	}
+	if len(input.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "At least one scope is required"})
+	}
+	for _, s := range input.Scopes {
+		if !scope.Valid(s) || s == scope.Account {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scope " + strconv.Quote(s)})
+		}
+	}
+
+	// A key can never do more than the member it acts for
+	if !policy.HasScopes(user, input.Scopes...) {
+		return policy.Forbidden(c)
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "expiresAt must be in the future"})
+	}
+
+	key, prefix, hash, err := utils.NewAPIKey()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create API key"})
+	}
+
+	apiKey := models.APIKey{
+		OrganisationID: organisation.ID,
+		CreatedByID:    user.ID,
+		Name:           input.Name,
+		Prefix:         prefix,
+		KeyHash:        hash,
+		Scopes:         input.Scopes,
+		ExpiresAt:      input.ExpiresAt,
+	}
+	if err := h.DB.Create(&apiKey).Error; err != nil {
+		log.Printf("Error creating API key for organisation %d: %v", organisation.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create API key"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"key": key, "apiKey": apiKey})
+}
+
+func (h *OrganisationHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	organisation, err := h.findOrganisation(c)
+	if organisation == nil {
+		return err
+	}
+	if !managesKeys(middleware.CurrentUser(c), organisation) {
+		return policy.Forbidden(c)
+	}
+
+	result := h.DB.Model(&models.APIKey{}).
+		Where("id = ? AND organisation_id = ? AND revoked_at IS NULL", c.Params("keyId"), organisation.ID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke API key"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "API key not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "API key revoked"})
+}
+
+// findOrganisation loads the organisation named in the route if the caller
+// is one of its members or an admin. Otherwise it writes the error response
+// and returns a nil organisation.
+func (h *OrganisationHandler) findOrganisation(c *fiber.Ctx) (*models.Organisation, error) {
+	var organisation models.Organisation
+	if err := h.DB.First(&organisation, c.Params("id")).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Organisation not found"})
+	}
+
+	user := middleware.CurrentUser(c)
+	if user.OrganisationID != organisation.ID && !policy.IsAdmin(user) {
+		return nil, policy.Forbidden(c)
+	}
+
+	return &organisation, nil
+}
+
+// managesKeys reports whether user may list and revoke the organisation's
+// API keys: its own admins and site admins.
+func managesKeys(user *middleware.AuthUser, organisation *models.Organisation) bool {
+	if policy.IsAdmin(user) {
+		return true
+	}
+	return user.OrganisationID == organisation.ID && user.OrganisationRole == models.OrganisationRoleAdmin
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/mailer"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	passwordResetTTL  = time.Hour
+	minPasswordLength = 8
+)
+
+var errResetTokenInvalid = errors.New("reset token is invalid or has expired")
+
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	// Respond identically whether or not the account exists so the endpoint
+	// cannot be used to discover registered emails.
+	response := fiber.Map{"message": "If an account exists for that email, a reset link has been sent"}
+
+	var user models.User
+	if err := h.DB.Where("email = ?", strings.TrimSpace(input.Email)).First(&user).Error; err != nil {
+		return c.JSON(response)
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create reset token"})
+	}
+
+	now := time.Now()
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the most recently requested link works
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: now.Add(passwordResetTTL),
+		}).Error
+	})
+	if err != nil {
+		log.Printf("Error creating password reset token for user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create reset token"})
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.Config.AppURL, url.QueryEscape(token))
+	err = h.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nWe received a request to reset your password. "+
+			"Use the link below within the next hour to choose a new one:\n\n%s\n\n"+
+			"If you did not request this, you can ignore this email.", user.Name, link),
+	})
+	if err != nil {
+		log.Printf("Error sending password reset email to user %d: %v", user.ID, err)
+	}
+
+	return c.JSON(response)
+}
+
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	input.Password = strings.TrimSpace(input.Password)
+	if len(input.Password) < minPasswordLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Password must be at least %d characters", minPasswordLength)})
+	}
+
+	now := time.Now()
+	var reset models.PasswordResetToken
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(input.Token), now).
+			First(&reset).Error; err != nil {
+			return errResetTokenInvalid
+		}
+
+		// Claim the token atomically so it cannot be used twice
+		result := tx.Model(&reset).Where("used_at IS NULL").Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errResetTokenInvalid
+		}
+
+		var user models.User
+		if err := tx.First(&user, reset.UserID).Error; err != nil {
+			return err
+		}
+
+		// The User model's BeforeSave hook hashes the new password
+		user.Password = input.Password
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+
+		return revokeAllSessions(tx, reset.UserID)
+	})
+	if errors.Is(err, errResetTokenInvalid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Reset token is invalid or has expired"})
+	}
+	if err != nil {
+		log.Printf("Error resetting password: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reset password"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Password has been reset. Please log in again."})
+}
@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const maxPreferredTimes = 10
+
+// errRequestChanged aborts accepting a request that was changed by someone
+// else since it was loaded.
+var errRequestChanged = errors.New("request changed concurrently")
+
+type RequestHandler struct {
+	DB *gorm.DB
+}
+
+func NewRequestHandler(db *gorm.DB) *RequestHandler {
+	return &RequestHandler{DB: db}
+}
+
+// CreateRequest posts a tutoring request to one tutor, or to the open board
+// when tutorId is left out.
+func (h *RequestHandler) CreateRequest(c *fiber.Ctx) error {
+	var input struct {
+		TutorID        *uint              `json:"tutorId"`
+		StudentID      uint               `json:"studentId"`
+		Subject        string             `json:"subject"`
+		Budget         int64              `json:"budget"`
+		PreferredTimes []models.TimeRange `json:"preferredTimes"`
+		Message        string             `json:"message"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	// Admins may post on behalf of a student
+	user := middleware.CurrentUser(c)
+	if !policy.IsAdmin(user) || input.StudentID == 0 {
+		input.StudentID = user.ID
+	}
+
+	input.Subject = strings.TrimSpace(input.Subject)
+	if input.Subject == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "subject is required"})
+	}
+	if input.Budget <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "budget must be a positive hourly rate in minor currency units"})
+	}
+	if len(input.PreferredTimes) > maxPreferredTimes {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("At most %d preferred times are allowed", maxPreferredTimes)})
+	}
+	now := time.Now()
+	for _, t := range input.PreferredTimes {
+		if msg := validateSessionTimes(t.Start, t.End, now); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "preferredTimes: " + msg})
+		}
+	}
+
+	if input.TutorID != nil {
+		if *input.TutorID == input.StudentID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You cannot send a request to yourself"})
+		}
+		var tutor models.Tutor
+		if err := h.DB.Where("user_id = ?", *input.TutorID).First(&tutor).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tutor not found"})
+		}
+	}
+
+	request := models.TutoringRequest{
+		StudentID:      input.StudentID,
+		TutorID:        input.TutorID,
+		Subject:        input.Subject,
+		Budget:         input.Budget,
+		PreferredTimes: input.PreferredTimes,
+		Message:        strings.TrimSpace(input.Message),
+		Status:         models.RequestPending,
+	}
+	if err := h.DB.Create(&request).Error; err != nil {
+		log.Printf("Error creating tutoring request: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create request"})
+	}
+
+	request.Localize(user.Location())
+	return c.Status(fiber.StatusCreated).JSON(viewRequest(&request))
+}
+
+// GetRequests lists the requests the caller sent or received, newest
+// first. With ?board=true tutors see the pending requests on the open
+// board instead.
+func (h *RequestHandler) GetRequests(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	query := h.DB.Preload("Student").Preload("Tutor")
+	if c.QueryBool("board") {
+		if !policy.HasRole(user, models.UserTypeTutor, models.UserTypeAdmin) {
+			return policy.Forbidden(c)
+		}
+		query = query.Where("tutor_id IS NULL AND status = ?", models.RequestPending)
+	} else {
+		query = query.Where("(student_id = ? OR tutor_id = ?)", user.ID, user.ID)
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+	}
+
+	var requests []models.TutoringRequest
+	if err := query.Order("created_at DESC").Find(&requests).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch requests"})
+	}
+
+	loc := user.Location()
+	for i := range requests {
+		requests[i].Localize(loc)
+	}
+	views := make([]requestView, len(requests))
+	for i := range requests {
+		views[i] = viewRequest(&requests[i])
+	}
+	return c.JSON(views)
+}
+
+func (h *RequestHandler) GetRequest(c *fiber.Ctx) error {
+	request, err := h.findRequest(c)
+	if request == nil {
+		return err
+	}
+
+	request.Localize(middleware.CurrentUser(c).Location())
+	return c.JSON(viewRequest(request))
+}
+
+// publicUser is what users may see of each other's accounts.
+type publicUser struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// publicUserOf returns the public details of user, or nil if it was not
+// loaded.
+func publicUserOf(user *models.User) *publicUser {
+	if user == nil || user.ID == 0 {
+		return nil
+	}
+	return &publicUser{ID: user.ID, Name: user.Name}
+}
+
+// requestView is a request as the API returns it, with only the public
+// details of its student and tutor. Open requests are shown this way to
+// every tutor browsing the board.
+type requestView struct {
+	models.TutoringRequest
+	Student *publicUser `json:"student,omitempty"`
+	Tutor   *publicUser `json:"tutor,omitempty"`
+}
+
+func viewRequest(request *models.TutoringRequest) requestView {
+	return requestView{
+		TutoringRequest: *request,
+		Student:         publicUserOf(&request.Student),
+		Tutor:           publicUserOf(request.Tutor),
+	}
+}
+
+// CounterRequest proposes a different hourly rate. Countering an open
+// request claims it for the tutor; the student then accepts or declines.
+func (h *RequestHandler) CounterRequest(c *fiber.Ctx) error {
+	var input struct {
+		Rate    int64  `json:"rate"`
+		Message string `json:"message"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	request, err := h.findRequest(c)
+	if request == nil {
+		return err
+	}
+
+	if !request.CanTransition(models.RequestCountered) || request.Status != models.RequestPending {
+		return invalidRequestTransition(c, "counter", request)
+	}
+	user := middleware.CurrentUser(c)
+	if !h.isAnsweringTutor(user, request) {
+		return policy.Forbidden(c)
+	}
+	if input.Rate <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "rate must be a positive hourly rate in minor currency units"})
+	}
+
+	return h.updateRequest(c, request, map[string]interface{}{
+		"status":          models.RequestCountered,
+		"tutor_id":        user.ID,
+		"counter_rate":    input.Rate,
+		"counter_message": strings.TrimSpace(input.Message),
+	})
+}
+
+// AcceptRequest agrees to a request at its budget, or to a counter-offer at
+// the countered rate. Pending requests are accepted by the tutor and
+// counter-offers by the student. Unless createChat is false a chat between
+// the two is opened, and when startTime and endTime are given a session is
+// booked: confirmed straight away if the tutor picks one of the student's
+// preferred times, otherwise requested until the other party confirms it.
+func (h *RequestHandler) AcceptRequest(c *fiber.Ctx) error {
+	var input struct {
+		StartTime  time.Time `json:"startTime"`
+		EndTime    time.Time `json:"endTime"`
+		CreateChat *bool     `json:"createChat"`
+	}
+
+	if err := c.BodyParser(&input); err != nil && len(c.Body()) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	request, err := h.findRequest(c)
+	if request == nil {
+		return err
+	}
+
+	if !request.CanTransition(models.RequestAccepted) {
+		return invalidRequestTransition(c, "accept", request)
+	}
+	user := middleware.CurrentUser(c)
+	var tutorID uint
+	if request.Status == models.RequestPending {
+		if !h.isAnsweringTutor(user, request) {
+			return policy.Forbidden(c)
+		}
+		tutorID = user.ID
+	} else {
+		if !policy.IsOwnerOrAdmin(user, request.StudentID) {
+			return policy.Forbidden(c)
+		}
+		tutorID = *request.TutorID
+	}
+
+	now := time.Now()
+	bookSession := !input.StartTime.IsZero() || !input.EndTime.IsZero()
+	if bookSession {
+		if msg := validateSessionTimes(input.StartTime, input.EndTime, now); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+		}
+	}
+
+	var participants []models.User
+	if err := h.DB.Where("id IN ?", []uint{request.StudentID, tutorID}).Find(&participants).Error; err != nil || len(participants) != 2 {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch participants"})
+	}
+
+	updates := map[string]interface{}{
+		"status":   models.RequestAccepted,
+		"tutor_id": tutorID,
+	}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if input.CreateChat == nil || *input.CreateChat {
+			chat := models.Chat{Participants: participants}
+			if err := tx.Create(&chat).Error; err != nil {
+				return err
+			}
+			updates["chat_id"] = chat.ID
+		}
+
+		if bookSession {
+			session := models.Session{
+				TutorID:       tutorID,
+				StudentID:     request.StudentID,
+				Subject:       request.Subject,
+				StartTime:     input.StartTime,
+				EndTime:       input.EndTime,
+				Price:         int64(math.Round(float64(request.AgreedRate()) * input.EndTime.Sub(input.StartTime).Hours())),
+				Status:        models.SessionRequested,
+				RequestedByID: user.ID,
+			}
+			// The student already proposed this time, so both have agreed to it
+			if user.ID == tutorID && request.PrefersTime(input.StartTime, input.EndTime) {
+				session.Status = models.SessionConfirmed
+			}
+			if err := expireHolds(tx, tutorID, now); err != nil {
+				return err
+			}
+			if err := tx.Create(&session).Error; err != nil {
+				return err
+			}
+			updates["session_id"] = session.ID
+		}
+
+		result := tx.Model(&models.TutoringRequest{}).
+			Where("id = ? AND updated_at = ?", request.ID, request.UpdatedAt).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRequestChanged
+		}
+		return nil
+	})
+	switch {
+	case isSessionOverlap(err):
+		return sessionOverlap(c)
+	case errors.Is(err, errRequestChanged):
+		return requestChanged(c)
+	case err != nil:
+		log.Printf("Error accepting request %d: %v", request.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to accept request"})
+	}
+
+	return h.respondWithRequest(c, request)
+}
+
+// DeclineRequest turns a request down: a pending one by its tutor, or a
+// counter-offer by the student. Open requests are simply left for another
+// tutor.
+func (h *RequestHandler) DeclineRequest(c *fiber.Ctx) error {
+	request, err := h.findRequest(c)
+	if request == nil {
+		return err
+	}
+
+	if !request.CanTransition(models.RequestDeclined) || request.IsOpen() {
+		return invalidRequestTransition(c, "decline", request)
+	}
+	user := middleware.CurrentUser(c)
+	if request.Status == models.RequestPending && !h.isAnsweringTutor(user, request) {
+		return policy.Forbidden(c)
+	}
+	if request.Status == models.RequestCountered && !policy.IsOwnerOrAdmin(user, request.StudentID) {
+		return policy.Forbidden(c)
+	}
+
+	return h.updateRequest(c, request, map[string]interface{}{"status": models.RequestDeclined})
+}
+
+// WithdrawRequest lets the student take back a request nobody has accepted.
+func (h *RequestHandler) WithdrawRequest(c *fiber.Ctx) error {
+	request, err := h.findRequest(c)
+	if request == nil {
+		return err
+	}
+
+	if !request.CanTransition(models.RequestWithdrawn) {
+		return invalidRequestTransition(c, "withdraw", request)
+	}
+	if !policy.IsOwnerOrAdmin(middleware.CurrentUser(c), request.StudentID) {
+		return policy.Forbidden(c)
+	}
+
+	return h.updateRequest(c, request, map[string]interface{}{"status": models.RequestWithdrawn})
+}
+
+// isAnsweringTutor reports whether user is the tutor a request is waiting
+// on: its own tutor, or any tutor for an open request.
+func (h *RequestHandler) isAnsweringTutor(user *middleware.AuthUser, request *models.TutoringRequest) bool {
+	if user.UserType != models.UserTypeTutor || user.ID == request.StudentID {
+		return false
+	}
+	if request.IsOpen() {
+		var count int64
+		h.DB.Model(&models.Tutor{}).Where("user_id = ?", user.ID).Count(&count)
+		return count > 0
+	}
+	return *request.TutorID == user.ID
+}
+
+// findRequest loads the request named in the route if the caller may see
+// it: its student and tutor, admins, and any tutor while it is open.
+// Otherwise it writes the error response and returns a nil request.
+func (h *RequestHandler) findRequest(c *fiber.Ctx) (*models.TutoringRequest, error) {
+	var request models.TutoringRequest
+	if err := h.DB.Preload("Student").Preload("Tutor").First(&request, c.Params("id")).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Request not found"})
+	}
+
+	user := middleware.CurrentUser(c)
+	switch {
+	case request.StudentID == user.ID, request.TutorID != nil && *request.TutorID == user.ID, policy.IsAdmin(user):
+	case request.IsOpen() && user.UserType == models.UserTypeTutor:
+	default:
+		return nil, policy.Forbidden(c)
+	}
+
+	return &request, nil
+}
+
+// updateRequest applies updates unless the request changed since it was
+// loaded.
+func (h *RequestHandler) updateRequest(c *fiber.Ctx, request *models.TutoringRequest, updates map[string]interface{}) error {
+	result := h.DB.Model(&models.TutoringRequest{}).
+		Where("id = ? AND updated_at = ?", request.ID, request.UpdatedAt).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("Error updating request %d: %v", request.ID, result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update request"})
+	}
+	if result.RowsAffected == 0 {
+		return requestChanged(c)
+	}
+
+	return h.respondWithRequest(c, request)
+}
+
+func (h *RequestHandler) respondWithRequest(c *fiber.Ctx, request *models.TutoringRequest) error {
+	if err := h.DB.Preload("Student").Preload("Tutor").First(request, request.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch request"})
+	}
+	request.Localize(middleware.CurrentUser(c).Location())
+	return c.JSON(viewRequest(request))
+}
+
+func requestChanged(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Request was changed by someone else, please reload it"})
+}
+
+func invalidRequestTransition(c *fiber.Ctx, action string, request *models.TutoringRequest) error {
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": fmt.Sprintf("Cannot %s a %s request", action, request.Status)})
+}
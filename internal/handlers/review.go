@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxReviewComment = 2000
+
+// ReviewSession records the student's rating of a completed session and
+// updates the tutor's average rating.
+func (h *SessionHandler) ReviewSession(c *fiber.Ctx) error {
+	var input struct {
+		Rating  int    `json:"rating"`
+		Comment string `json:"comment"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	session, err := h.findSession(c)
+	if session == nil {
+		return err
+	}
+
+	if session.StudentID != middleware.CurrentUser(c).ID {
+		return policy.Forbidden(c)
+	}
+	if session.Status != models.SessionCompleted {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Only completed sessions can be reviewed"})
+	}
+	input.Comment = strings.TrimSpace(input.Comment)
+	if input.Rating < 1 || input.Rating > 5 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "rating must be from 1 to 5"})
+	}
+	if len(input.Comment) > maxReviewComment {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "comment must be at most 2000 bytes"})
+	}
+
+	review := models.Review{
+		SessionID: session.ID,
+		TutorID:   session.TutorID,
+		StudentID: session.StudentID,
+		Rating:    input.Rating,
+		Comment:   input.Comment,
+	}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the profile so concurrent reviews each see the other's rating
+		var tutor models.Tutor
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", session.TutorID).First(&tutor).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		return tx.Model(&tutor).Updates(map[string]interface{}{
+			"rating_count":   gorm.Expr("(SELECT count(*) FROM reviews WHERE tutor_id = ?)", session.TutorID),
+			"rating_average": gorm.Expr("(SELECT COALESCE(avg(rating), 0) FROM reviews WHERE tutor_id = ?)", session.TutorID),
+		}).Error
+	})
+	if err != nil && strings.Contains(err.Error(), models.ReviewSessionConstraint) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Session has already been reviewed"})
+	}
+	if err != nil {
+		log.Printf("Error reviewing session %d: %v", session.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save review"})
+	}
+
+	review.CreatedAt = review.CreatedAt.In(middleware.CurrentUser(c).Location())
+	return c.Status(fiber.StatusCreated).JSON(review)
+}
+
+// GetReviews lists a tutor's reviews, newest first.
+func (h *TutorHandler) GetReviews(c *fiber.Ctx) error {
+	var tutor models.Tutor
+	if err := h.DB.First(&tutor, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tutor not found"})
+	}
+
+	limit := c.QueryInt("limit", defaultSearchLimit)
+	if limit < 1 || limit > maxSearchLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be from 1 to 100"})
+	}
+
+	var reviews []models.Review
+	if err := h.DB.Select("reviews.*, users.name AS student_name").
+		Joins("JOIN users ON users.id = reviews.student_id").
+		Where("reviews.tutor_id = ?", tutor.UserID).
+		Order("reviews.created_at DESC").
+		Limit(limit).
+		Find(&reviews).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch reviews"})
+	}
+
+	loc := middleware.CurrentUser(c).Location()
+	for i := range reviews {
+		reviews[i].CreatedAt = reviews[i].CreatedAt.In(loc)
+	}
+	return c.JSON(fiber.Map{
+		"ratingAverage": tutor.RatingAverage,
+		"ratingCount":   tutor.RatingCount,
+		"reviews":       reviews,
+	})
+}
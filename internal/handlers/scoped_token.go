@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
+	"github.com/OPTIC7409/tutor-api/internal/scope"
+	"github.com/OPTIC7409/tutor-api/internal/signing"
+	"github.com/OPTIC7409/tutor-api/internal/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// scopedTokenMaxTTL caps limited tokens, which cannot be refreshed. Their
+// signing key must still be published when they expire.
+const scopedTokenMaxTTL = signing.MaxTokenTTL
+
+// CreateScopedToken mints an access token limited to some of the caller's
+// scopes, e.g. a read-only token for a dashboard widget. The token belongs
+// to the caller's session and is revoked with it.
+func (h *AuthHandler) CreateScopedToken(c *fiber.Ctx) error {
+	var input struct {
+		Scopes    []string `json:"scopes"`
+		ExpiresIn int      `json:"expiresIn"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	if len(input.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "At least one scope is required"})
+	}
+	for _, s := range input.Scopes {
+		if !scope.Valid(s) || s == scope.Account {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scope " + strconv.Quote(s)})
+		}
+	}
+
+	current := middleware.CurrentUser(c)
+	if !policy.HasScopes(current, input.Scopes...) {
+		return policy.Forbidden(c)
+	}
+
+	ttl := utils.AccessTokenTTL
+	if input.ExpiresIn != 0 {
+		ttl = time.Duration(input.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > scopedTokenMaxTTL {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("expiresIn must be between 1 and %d seconds", int(scopedTokenMaxTTL.Seconds()))})
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, current.ID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	scopes := scope.Intersect(input.Scopes, current.Scopes)
+	token, err := utils.GenerateScopedToken(h.Keys, &user, current.SessionID, scopes, ttl)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"token":     token,
+		"scopes":    scopes,
+		"expiresIn": int(ttl.Seconds()),
+	})
+}
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
+	"github.com/OPTIC7409/tutor-api/internal/scheduling"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Values of applyTo when rescheduling or cancelling a session in a series.
+const (
+	applyToThis      = "this"
+	applyToFollowing = "following"
+)
+
+// errSessionChanged aborts a transaction when a session was changed by
+// someone else since it was loaded.
+var errSessionChanged = errors.New("session changed concurrently")
+
+// CreateSeries books the same slot with a tutor every week or every other
+// week. Every occurrence is created as a requested session in one
+// transaction, so either the whole series is booked or none of it is.
+func (h *SessionHandler) CreateSeries(c *fiber.Ctx) error {
+	var input struct {
+		TutorID   uint       `json:"tutorId"`
+		StudentID uint       `json:"studentId"`
+		Subject   string     `json:"subject"`
+		StartTime time.Time  `json:"startTime"`
+		EndTime   time.Time  `json:"endTime"`
+		Frequency string     `json:"frequency"`
+		Count     *int       `json:"count"`
+		Until     *time.Time `json:"until"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	// Admins may book on behalf of a student
+	user := middleware.CurrentUser(c)
+	if !policy.IsAdmin(user) || input.StudentID == 0 {
+		input.StudentID = user.ID
+	}
+
+	now := time.Now()
+	if input.TutorID == input.StudentID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You cannot book a session with yourself"})
+	}
+	if msg := validateSessionTimes(input.StartTime, input.EndTime, now); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if input.Frequency == "" {
+		input.Frequency = models.SeriesWeekly
+	}
+	if input.Frequency != models.SeriesWeekly && input.Frequency != models.SeriesBiweekly {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "frequency must be weekly or biweekly"})
+	}
+	if (input.Count == nil) == (input.Until == nil) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Either count or until is required"})
+	}
+	if input.Count != nil && (*input.Count < 1 || *input.Count > models.MaxSeriesOccurrences) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("count must be between 1 and %d", models.MaxSeriesOccurrences)})
+	}
+	if input.Until != nil && input.Until.Before(input.StartTime) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "until must not be before startTime"})
+	}
+
+	var tutor models.Tutor
+	if err := h.DB.Where("user_id = ?", input.TutorID).First(&tutor).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tutor not found"})
+	}
+	loc := scheduling.LocationOrUTC(tutor.TimeZone)
+
+	subject := strings.TrimSpace(input.Subject)
+	if subject == "" {
+		subject = tutor.Subject
+	}
+
+	series := models.SessionSeries{
+		TutorID:       input.TutorID,
+		StudentID:     input.StudentID,
+		Subject:       subject,
+		StartTime:     input.StartTime,
+		EndTime:       input.EndTime,
+		TimeZone:      loc.String(),
+		Frequency:     input.Frequency,
+		Count:         input.Count,
+		Until:         input.Until,
+		RequestedByID: user.ID,
+	}
+
+	count, until := 0, time.Time{}
+	if input.Count != nil {
+		count = *input.Count
+	} else {
+		until = *input.Until
+	}
+	// One occurrence past the limit is enough to reject an until years away
+	starts := scheduling.Recur(input.StartTime, loc, series.IntervalWeeks(), count, until, models.MaxSeriesOccurrences+1)
+	if len(starts) > models.MaxSeriesOccurrences {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("A series can book at most %d sessions", models.MaxSeriesOccurrences)})
+	}
+
+	length := input.EndTime.Sub(input.StartTime)
+	rate := subjectRate(h.DB, &tutor, subject)
+	sessions := make([]models.Session, len(starts))
+	for i, start := range starts {
+		sessions[i] = models.Session{
+			TutorID:       series.TutorID,
+			StudentID:     series.StudentID,
+			Subject:       series.Subject,
+			StartTime:     start,
+			EndTime:       start.Add(length),
+			Price:         int64(math.Round(rate * length.Hours())),
+			Status:        models.SessionRequested,
+			RequestedByID: user.ID,
+		}
+	}
+
+	var conflicts []time.Time
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := expireHolds(tx, series.TutorID, now); err != nil {
+			return err
+		}
+
+		// Name the clashing dates rather than just refusing the series
+		for _, s := range sessions {
+			var clashes int64
+			if err := tx.Model(&models.Session{}).
+				Where("tutor_id = ? AND status IN ? AND start_time < ? AND end_time > ?",
+					s.TutorID, models.ActiveSessionStatuses, s.EndTime, s.StartTime).
+				Count(&clashes).Error; err != nil {
+				return err
+			}
+			if clashes > 0 {
+				conflicts = append(conflicts, s.StartTime)
+			}
+		}
+		if len(conflicts) > 0 {
+			return nil
+		}
+
+		if err := tx.Create(&series).Error; err != nil {
+			return err
+		}
+		for i := range sessions {
+			sessions[i].SeriesID = &series.ID
+		}
+		return tx.Create(&sessions).Error
+	})
+	if isSessionOverlap(err) {
+		return sessionOverlap(c)
+	}
+	if err != nil {
+		log.Printf("Error creating session series: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to book series"})
+	}
+	if len(conflicts) > 0 {
+		for i := range conflicts {
+			conflicts[i] = conflicts[i].In(user.Location())
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":     "The tutor already has sessions at some of these times",
+			"conflicts": conflicts,
+		})
+	}
+
+	series.Localize(user.Location())
+	localizeSessions(c, sessions)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"series": series, "sessions": viewSessions(sessions)})
+}
+
+// GetSeries returns a series with all of its occurrences.
+func (h *SessionHandler) GetSeries(c *fiber.Ctx) error {
+	var series models.SessionSeries
+	if err := h.DB.First(&series, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Series not found"})
+	}
+
+	user := middleware.CurrentUser(c)
+	if series.TutorID != user.ID && series.StudentID != user.ID && !policy.IsAdmin(user) {
+		return policy.Forbidden(c)
+	}
+
+	var sessions []models.Session
+	if err := h.DB.Where("series_id = ?", series.ID).Order("start_time").Find(&sessions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch series"})
+	}
+
+	series.Localize(middleware.CurrentUser(c).Location())
+	localizeSessions(c, sessions)
+	return c.JSON(fiber.Map{"series": series, "sessions": viewSessions(sessions)})
+}
+
+// rescheduleFollowing moves session and every later active occurrence of its
+// series to the new day and time. The series is split in two: the original
+// ends before session, and a new one starts at the new time.
+func (h *SessionHandler) rescheduleFollowing(c *fiber.Ctx, session *models.Session, start, end time.Time) error {
+	user := middleware.CurrentUser(c)
+	series, following, err := h.findFollowing(c, session)
+	if series == nil {
+		return err
+	}
+
+	loc := scheduling.LocationOrUTC(series.TimeZone)
+
+	// Each occurrence moves by the same number of days and takes the new
+	// wall-clock time, so daylight saving changes do not shift it
+	oldLocal, newLocal := session.StartTime.In(loc), start.In(loc)
+	dayShift := civilDays(newLocal) - civilDays(oldLocal)
+	length := end.Sub(start)
+
+	moved := make([]models.Session, len(following))
+	for i, f := range following {
+		local := f.StartTime.In(loc)
+		f.StartTime = time.Date(local.Year(), local.Month(), local.Day()+dayShift,
+			newLocal.Hour(), newLocal.Minute(), newLocal.Second(), 0, loc)
+		f.EndTime = f.StartTime.Add(length)
+		f.Price = int64(math.Round(float64(f.Price) * float64(length) / float64(following[i].Duration())))
+		moved[i] = f
+	}
+
+	// Update in the direction of travel so occurrences never collide with
+	// their not yet moved neighbours
+	if start.After(session.StartTime) {
+		sort.Slice(moved, func(i, j int) bool { return moved[i].StartTime.After(moved[j].StartTime) })
+	}
+
+	tail := *series
+	tail.ID = 0
+	tail.StartTime, tail.EndTime = start, end
+	tail.RequestedByID = user.ID
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := expireHolds(tx, session.TutorID, time.Now()); err != nil {
+			return err
+		}
+		seriesID, err := splitSeries(tx, series, &tail, session.StartTime)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range moved {
+			result := tx.Model(&models.Session{}).
+				Where("id = ? AND updated_at = ?", m.ID, m.UpdatedAt).
+				Updates(map[string]interface{}{
+					"series_id":       seriesID,
+					"status":          models.SessionRequested,
+					"start_time":      m.StartTime,
+					"end_time":        m.EndTime,
+					"price":           m.Price,
+					"requested_by_id": user.ID,
+					"sequence":        gorm.Expr("sequence + 1"),
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errSessionChanged
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return h.seriesUpdateFailed(c, session, err)
+	}
+
+	return h.respondWithSeries(c, session)
+}
+
+// cancelFollowing cancels session and every later active occurrence of its
+// series, and ends the series before session.
+func (h *SessionHandler) cancelFollowing(c *fiber.Ctx, session *models.Session, reason string) error {
+	series, following, err := h.findFollowing(c, session)
+	if series == nil {
+		return err
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := splitSeries(tx, series, nil, session.StartTime); err != nil {
+			return err
+		}
+
+		for _, f := range following {
+			result := tx.Model(&models.Session{}).
+				Where("id = ? AND updated_at = ?", f.ID, f.UpdatedAt).
+				Updates(map[string]interface{}{
+					"status":              models.SessionCancelled,
+					"cancelled_by_id":     middleware.CurrentUser(c).ID,
+					"cancellation_reason": reason,
+					"sequence":            gorm.Expr("sequence + 1"),
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errSessionChanged
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return h.seriesUpdateFailed(c, session, err)
+	}
+
+	return h.respondWithSeries(c, session)
+}
+
+// findFollowing loads session's series and its requested or confirmed
+// occurrences from session onwards. Otherwise it writes the error response
+// and returns a nil series.
+func (h *SessionHandler) findFollowing(c *fiber.Ctx, session *models.Session) (*models.SessionSeries, []models.Session, error) {
+	if session.SeriesID == nil {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only sessions in a series can apply changes to following sessions"})
+	}
+
+	var series models.SessionSeries
+	if err := h.DB.First(&series, *session.SeriesID).Error; err != nil {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Series not found"})
+	}
+
+	var following []models.Session
+	if err := h.DB.Where("series_id = ? AND start_time >= ? AND status IN ?",
+		series.ID, session.StartTime, []string{models.SessionRequested, models.SessionConfirmed}).
+		Order("start_time").Find(&following).Error; err != nil {
+		return nil, nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch series"})
+	}
+
+	return &series, following, nil
+}
+
+// splitSeries ends series just before at and, when tail is given, saves it
+// as the series the later occurrences move to. If at is the first
+// occurrence the series is reused for tail instead. It returns the ID of
+// the series the later occurrences belong to.
+func splitSeries(tx *gorm.DB, series, tail *models.SessionSeries, at time.Time) (uint, error) {
+	var before int64
+	if err := tx.Model(&models.Session{}).
+		Where("series_id = ? AND start_time < ?", series.ID, at).
+		Count(&before).Error; err != nil {
+		return 0, err
+	}
+
+	if before == 0 {
+		if tail == nil {
+			return series.ID, nil
+		}
+		return series.ID, tx.Model(series).Updates(map[string]interface{}{
+			"start_time":      tail.StartTime,
+			"end_time":        tail.EndTime,
+			"requested_by_id": tail.RequestedByID,
+		}).Error
+	}
+
+	updates := map[string]interface{}{}
+	if series.Count != nil {
+		updates["count"] = before
+		if tail != nil {
+			remaining := *series.Count - int(before)
+			tail.Count = &remaining
+		}
+	} else {
+		updates["until"] = at.Add(-time.Second)
+	}
+	if err := tx.Model(series).Updates(updates).Error; err != nil {
+		return 0, err
+	}
+
+	if tail == nil {
+		return series.ID, nil
+	}
+	if err := tx.Create(tail).Error; err != nil {
+		return 0, err
+	}
+	return tail.ID, nil
+}
+
+func (h *SessionHandler) seriesUpdateFailed(c *fiber.Ctx, session *models.Session, err error) error {
+	switch {
+	case isSessionOverlap(err):
+		return sessionOverlap(c)
+	case errors.Is(err, errSessionChanged):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Session was changed by someone else, please reload it"})
+	}
+	log.Printf("Error updating series of session %d: %v", session.ID, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update series"})
+}
+
+// respondWithSeries writes the series session now belongs to, with all of
+// its occurrences.
+func (h *SessionHandler) respondWithSeries(c *fiber.Ctx, session *models.Session) error {
+	if err := h.DB.First(session, session.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch session"})
+	}
+
+	var series models.SessionSeries
+	var sessions []models.Session
+	if err := h.DB.First(&series, *session.SeriesID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch series"})
+	}
+	if err := h.DB.Where("series_id = ?", series.ID).Order("start_time").Find(&sessions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch series"})
+	}
+
+	series.Localize(middleware.CurrentUser(c).Location())
+	localizeSessions(c, sessions)
+	return c.JSON(fiber.Map{"series": series, "sessions": viewSessions(sessions)})
+}
+
+// civilDays numbers t's calendar date, ignoring its time and zone.
+func civilDays(t time.Time) int {
+	return int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+func validApplyTo(applyTo string) bool {
+	return applyTo == "" || applyTo == applyToThis || applyTo == applyToFollowing
+}
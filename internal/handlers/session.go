@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	minSessionLength = 15 * time.Minute
+	maxSessionLength = 8 * time.Hour
+)
+
+type SessionHandler struct {
+	DB *gorm.DB
+}
+
+func NewSessionHandler(db *gorm.DB) *SessionHandler {
+	return &SessionHandler{DB: db}
+}
+
+// RequestSession books a session with a tutor. It stays requested until the
+// tutor confirms it.
+func (h *SessionHandler) RequestSession(c *fiber.Ctx) error {
+	return h.createSession(c, models.SessionRequested)
+}
+
+// HoldSession reserves a slot for SessionHoldDuration while the student
+// pays. BookSession turns the hold into a request.
+func (h *SessionHandler) HoldSession(c *fiber.Ctx) error {
+	return h.createSession(c, models.SessionHeld)
+}
+
+// BookSession completes a held session once payment has gone through.
+func (h *SessionHandler) BookSession(c *fiber.Ctx) error {
+	session, err := h.findSession(c)
+	if session == nil {
+		return err
+	}
+
+	if session.Status != models.SessionHeld {
+		return invalidSessionTransition(c, "book", session)
+	}
+	user := middleware.CurrentUser(c)
+	if session.RequestedByID != user.ID && !policy.IsAdmin(user) {
+		return policy.Forbidden(c)
+	}
+	if session.HoldExpired(time.Now()) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The hold on this slot has expired"})
+	}
+
+	return h.updateSession(c, session, map[string]interface{}{
+		"status":          models.SessionRequested,
+		"hold_expires_at": nil,
+	})
+}
+
+// createSession books a session in the given status. The insert runs in a
+// transaction that first frees slots held by lapsed holds; the database's
+// exclusion constraint then rejects any overlap with the tutor's other
+// sessions, however many bookings race for the slot.
+func (h *SessionHandler) createSession(c *fiber.Ctx, status string) error {
+	var input struct {
+		TutorID   uint      `json:"tutorId"`
+		StudentID uint      `json:"studentId"`
+		Subject   string    `json:"subject"`
+		StartTime time.Time `json:"startTime"`
+		EndTime   time.Time `json:"endTime"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	// Admins may book on behalf of a student
+	user := middleware.CurrentUser(c)
+	if !policy.IsAdmin(user) || input.StudentID == 0 {
+		input.StudentID = user.ID
+	}
+
+	now := time.Now()
+	if input.TutorID == input.StudentID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You cannot book a session with yourself"})
+	}
+	if msg := validateSessionTimes(input.StartTime, input.EndTime, now); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	var tutor models.Tutor
+	if err := h.DB.Where("user_id = ?", input.TutorID).First(&tutor).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tutor not found"})
+	}
+
+	subject := strings.TrimSpace(input.Subject)
+	if subject == "" {
+		subject = tutor.Subject
+	}
+
+	session := models.Session{
+		TutorID:       input.TutorID,
+		StudentID:     input.StudentID,
+		Subject:       subject,
+		StartTime:     input.StartTime,
+		EndTime:       input.EndTime,
+		Price:         int64(math.Round(subjectRate(h.DB, &tutor, subject) * input.EndTime.Sub(input.StartTime).Hours())),
+		Status:        status,
+		RequestedByID: user.ID,
+	}
+	if status == models.SessionHeld {
+		expiresAt := now.Add(models.SessionHoldDuration)
+		session.HoldExpiresAt = &expiresAt
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := expireHolds(tx, session.TutorID, now); err != nil {
+			return err
+		}
+		return tx.Create(&session).Error
+	})
+	if isSessionOverlap(err) {
+		return sessionOverlap(c)
+	}
+	if err != nil {
+		log.Printf("Error creating session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to request session"})
+	}
+
+	session.Localize(user.Location())
+	return c.Status(fiber.StatusCreated).JSON(viewSession(&session))
+}
+
+// GetSessions lists the sessions the caller teaches or attends.
+func (h *SessionHandler) GetSessions(c *fiber.Ctx) error {
+	userID := middleware.CurrentUser(c).ID
+
+	query := h.DB.Preload("Tutor").Preload("Student").
+		Where("tutor_id = ? OR student_id = ?", userID, userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var sessions []models.Session
+	if err := query.Order("start_time").Find(&sessions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch sessions"})
+	}
+
+	localizeSessions(c, sessions)
+	return c.JSON(viewSessions(sessions))
+}
+
+func (h *SessionHandler) GetSession(c *fiber.Ctx) error {
+	session, err := h.findSession(c)
+	if session == nil {
+		return err
+	}
+
+	session.Localize(middleware.CurrentUser(c).Location())
+	return c.JSON(viewSession(session))
+}
+
+// ConfirmSession accepts the proposed time. Only the party who did not
+// propose it can confirm.
+func (h *SessionHandler) ConfirmSession(c *fiber.Ctx) error {
+	session, err := h.findSession(c)
+	if session == nil {
+		return err
+	}
+
+	if !session.CanTransition(models.SessionConfirmed) {
+		return invalidSessionTransition(c, "confirm", session)
+	}
+	user := middleware.CurrentUser(c)
+	if session.Confirmer() != user.ID {
+		return policy.Forbidden(c)
+	}
+
+	return h.updateSession(c, session, map[string]interface{}{"status": models.SessionConfirmed})
+}
+
+// RescheduleSession proposes a new time. The session goes back to requested
+// until the other party confirms it. For a session in a series, applyTo
+// "following" moves every later occurrence as well.
+func (h *SessionHandler) RescheduleSession(c *fiber.Ctx) error {
+	var input struct {
+		StartTime time.Time `json:"startTime"`
+		EndTime   time.Time `json:"endTime"`
+		ApplyTo   string    `json:"applyTo"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	session, err := h.findSession(c)
+	if session == nil {
+		return err
+	}
+
+	if session.Status == models.SessionHeld || !session.CanTransition(models.SessionRequested) {
+		return invalidSessionTransition(c, "reschedule", session)
+	}
+	user := middleware.CurrentUser(c)
+	if !session.IsParticipant(user.ID) {
+		return policy.Forbidden(c)
+	}
+	if msg := validateSessionTimes(input.StartTime, input.EndTime, time.Now()); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if !validApplyTo(input.ApplyTo) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "applyTo must be this or following"})
+	}
+	if input.ApplyTo == applyToFollowing {
+		return h.rescheduleFollowing(c, session, input.StartTime, input.EndTime)
+	}
+
+	// Keep the agreed rate for the new length
+	price := int64(math.Round(float64(session.Price) * float64(input.EndTime.Sub(input.StartTime)) / float64(session.Duration())))
+
+	if err := expireHolds(h.DB, session.TutorID, time.Now()); err != nil {
+		log.Printf("Error expiring holds for tutor %d: %v", session.TutorID, err)
+	}
+
+	return h.updateSession(c, session, map[string]interface{}{
+		"status":          models.SessionRequested,
+		"start_time":      input.StartTime,
+		"end_time":        input.EndTime,
+		"price":           price,
+		"requested_by_id": user.ID,
+	})
+}
+
+// CancelSession cancels a session, or with applyTo "following" also every
+// later occurrence of its series.
+func (h *SessionHandler) CancelSession(c *fiber.Ctx) error {
+	var input struct {
+		Reason  string `json:"reason"`
+		ApplyTo string `json:"applyTo"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	session, err := h.findSession(c)
+	if session == nil {
+		return err
+	}
+
+	if !session.CanTransition(models.SessionCancelled) {
+		return invalidSessionTransition(c, "cancel", session)
+	}
+	if !validApplyTo(input.ApplyTo) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "applyTo must be this or following"})
+	}
+	if input.ApplyTo == applyToFollowing {
+		return h.cancelFollowing(c, session, strings.TrimSpace(input.Reason))
+	}
+
+	return h.updateSession(c, session, map[string]interface{}{
+		"status":              models.SessionCancelled,
+		"cancelled_by_id":     middleware.CurrentUser(c).ID,
+		"cancellation_reason": strings.TrimSpace(input.Reason),
+	})
+}
+
+// CompleteSession marks a confirmed session as completed once it has ended.
+func (h *SessionHandler) CompleteSession(c *fiber.Ctx) error {
+	session, err := h.findSession(c)
+	if session == nil {
+		return err
+	}
+
+	if !session.CanTransition(models.SessionCompleted) {
+		return invalidSessionTransition(c, "complete", session)
+	}
+	user := middleware.CurrentUser(c)
+	if session.TutorID != user.ID && !policy.IsAdmin(user) {
+		return policy.Forbidden(c)
+	}
+	if time.Now().Before(session.EndTime) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Session has not ended yet"})
+	}
+
+	return h.updateSession(c, session, map[string]interface{}{"status": models.SessionCompleted})
+}
+
+// findSession loads the session named in the route if the caller takes part
+// in it or is an admin. Otherwise it writes the error response and returns
+// a nil session.
+func (h *SessionHandler) findSession(c *fiber.Ctx) (*models.Session, error) {
+	var session models.Session
+	if err := h.DB.Preload("Tutor").Preload("Student").First(&session, c.Params("id")).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	user := middleware.CurrentUser(c)
+	if !session.IsParticipant(user.ID) && !policy.IsAdmin(user) {
+		return nil, policy.Forbidden(c)
+	}
+
+	return &session, nil
+}
+
+// updateSession applies updates unless the session changed since it was
+// loaded, so two concurrent transitions cannot both succeed.
+func (h *SessionHandler) updateSession(c *fiber.Ctx, session *models.Session, updates map[string]interface{}) error {
+	updates["sequence"] = gorm.Expr("sequence + 1")
+	result := h.DB.Model(&models.Session{}).
+		Where("id = ? AND updated_at = ?", session.ID, session.UpdatedAt).
+		Updates(updates)
+	if isSessionOverlap(result.Error) {
+		return sessionOverlap(c)
+	}
+	if result.Error != nil {
+		log.Printf("Error updating session %d: %v", session.ID, result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update session"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Session was changed by someone else, please reload it"})
+	}
+
+	if err := h.DB.Preload("Tutor").Preload("Student").First(session, session.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch session"})
+	}
+	session.Localize(middleware.CurrentUser(c).Location())
+	return c.JSON(viewSession(session))
+}
+
+// localizeSessions converts sessions to the caller's time zone.
+func localizeSessions(c *fiber.Ctx, sessions []models.Session) {
+	loc := middleware.CurrentUser(c).Location()
+	for i := range sessions {
+		sessions[i].Localize(loc)
+	}
+}
+
+// sessionView is a session as the API returns it, with only the public
+// details of its tutor and student.
+type sessionView struct {
+	models.Session
+	Tutor   *publicUser `json:"tutor,omitempty"`
+	Student *publicUser `json:"student,omitempty"`
+}
+
+func viewSession(session *models.Session) sessionView {
+	return sessionView{
+		Session: *session,
+		Tutor:   publicUserOf(&session.Tutor),
+		Student: publicUserOf(&session.Student),
+	}
+}
+
+func viewSessions(sessions []models.Session) []sessionView {
+	views := make([]sessionView, len(sessions))
+	for i := range sessions {
+		views[i] = viewSession(&sessions[i])
+	}
+	return views
+}
+
+// expireHolds releases the tutor's holds that lapsed before the student
+// completed the booking, freeing their slots.
+func expireHolds(db *gorm.DB, tutorID uint, now time.Time) error {
+	return db.Model(&models.Session{}).
+		Where("tutor_id = ? AND status = ? AND hold_expires_at <= ?", tutorID, models.SessionHeld, now).
+		Update("status", models.SessionExpired).Error
+}
+
+// isSessionOverlap reports whether err comes from the constraint that stops
+// a tutor's active sessions from overlapping.
+func isSessionOverlap(err error) bool {
+	return err != nil && strings.Contains(err.Error(), models.SessionOverlapConstraint)
+}
+
+func sessionOverlap(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The tutor already has a session at this time"})
+}
+
+func invalidSessionTransition(c *fiber.Ctx, action string, session *models.Session) error {
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": fmt.Sprintf("Cannot %s a %s session", action, session.Status)})
+}
+
+// validateSessionTimes returns an error message when start and end do not
+// describe a bookable session.
+func validateSessionTimes(start, end, now time.Time) string {
+	switch {
+	case start.IsZero() || end.IsZero():
+		return "startTime and endTime are required"
+	case !start.After(now):
+		return "Sessions must start in the future"
+	case end.Sub(start) < minSessionLength:
+		return fmt.Sprintf("Sessions must last at least %d minutes", int(minSessionLength.Minutes()))
+	case end.Sub(start) > maxSessionLength:
+		return fmt.Sprintf("Sessions can last at most %d hours", int(maxSessionLength.Hours()))
+	}
+	return ""
+}
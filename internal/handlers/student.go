@@ -1,26 +1,40 @@
 package handlers
 
 import (
+	"github.com/OPTIC7409/tutor-api/internal/geocode"
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
 	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type StudentHandler struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Geocoder geocode.Geocoder
 }
 
-func NewStudentHandler(db *gorm.DB) *StudentHandler {
-	return &StudentHandler{DB: db}
+func NewStudentHandler(db *gorm.DB, geocoder geocode.Geocoder) *StudentHandler {
+	return &StudentHandler{DB: db, Geocoder: geocoder}
 }
 
 func (h *StudentHandler) CreateStudent(c *fiber.Ctx) error {
-	var student models.Student
-	if err := c.BodyParser(&student); err != nil {
+	var input studentInput
+	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	result := h.DB.Create(&student)
+	// Admins may create profiles on behalf of another user
+	user := middleware.CurrentUser(c)
+	student := models.Student{UserID: user.ID}
+	if policy.IsAdmin(user) && input.UserID != 0 {
+		student.UserID = input.UserID
+	}
+	input.apply(&student)
+	student.Latitude, student.Longitude = geolocate(c, h.Geocoder, student.Location)
+
+	result := h.DB.Omit(clause.Associations).Create(&student)
 	if err := result.Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create student"})
 	}
@@ -46,6 +60,10 @@ func (h *StudentHandler) GetStudent(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Student not found"})
 	}
 
+	if !canViewStudent(h.DB, middleware.CurrentUser(c), student.UserID) {
+		return policy.Forbidden(c)
+	}
+
 	return c.JSON(student)
 }
 
@@ -56,20 +74,77 @@ func (h *StudentHandler) UpdateStudent(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Student not found"})
 	}
 
-	if err := c.BodyParser(&student); err != nil {
+	if !policy.IsOwnerOrAdmin(middleware.CurrentUser(c), student.UserID) {
+		return policy.Forbidden(c)
+	}
+
+	var input studentInput
+	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	location := student.Location
+	input.apply(&student)
+	if student.Location != location || student.Latitude == nil {
+		student.Latitude, student.Longitude = geolocate(c, h.Geocoder, student.Location)
+	}
 
-	h.DB.Save(&student)
+	if err := h.DB.Omit(clause.Associations).Save(&student).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update student"})
+	}
 	return c.JSON(student)
 }
 
 func (h *StudentHandler) DeleteStudent(c *fiber.Ctx) error {
 	id := c.Params("id")
-	result := h.DB.Delete(&models.Student{}, id)
+	var student models.Student
+	if err := h.DB.First(&student, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Student not found"})
+	}
+
+	if !policy.IsOwnerOrAdmin(middleware.CurrentUser(c), student.UserID) {
+		return policy.Forbidden(c)
+	}
+
+	result := h.DB.Delete(&student)
 	if err := result.Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete student"})
 	}
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
+
+// canViewStudent reports whether user may see the profile of the student
+// with user ID studentID. Besides the student and admins, only tutors who
+// share a session, request or chat with the student may.
+func canViewStudent(db *gorm.DB, user *middleware.AuthUser, studentID uint) bool {
+	if policy.IsOwnerOrAdmin(user, studentID) {
+		return true
+	}
+	if !policy.HasRole(user, models.UserTypeTutor) {
+		return false
+	}
+
+	var teaches bool
+	err := db.Raw(`SELECT EXISTS (SELECT 1 FROM sessions WHERE tutor_id = ? AND student_id = ?)
+		OR EXISTS (SELECT 1 FROM requests WHERE tutor_id = ? AND student_id = ?)
+		OR EXISTS (SELECT 1 FROM chat_participants tutor
+			JOIN chat_participants student ON student.chat_id = tutor.chat_id
+			WHERE tutor.user_id = ? AND student.user_id = ?)`,
+		user.ID, studentID, user.ID, studentID, user.ID, studentID).Scan(&teaches).Error
+	return err == nil && teaches
+}
+
+// studentInput holds the profile fields a student may set. Fields left out
+// of an update keep their values.
+type studentInput struct {
+	UserID   uint    `json:"userId"` // Admins only, when creating a profile for someone else
+	Age      *int    `json:"age"`
+	Subjects *string `json:"subjects"`
+	Location *string `json:"location"`
+}
+
+func (input studentInput) apply(student *models.Student) {
+	setIfPresent(&student.Age, input.Age)
+	setIfPresent(&student.Subjects, input.Subjects)
+	setIfPresent(&student.Location, input.Location)
+}
@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	maxSubjectName     = 100
+	maxProfileSubjects = 50
+)
+
+// errSubjectExists aborts saving a subject whose path another subject
+// already has.
+var errSubjectExists = errors.New("subject already exists")
+
+type SubjectHandler struct {
+	DB *gorm.DB
+}
+
+func NewSubjectHandler(db *gorm.DB) *SubjectHandler {
+	return &SubjectHandler{DB: db}
+}
+
+// GetSubjects lists the catalogue ordered by path. ?q= filters by path and
+// ?tree=true nests each subject under its parent instead.
+func (h *SubjectHandler) GetSubjects(c *fiber.Ctx) error {
+	query := h.DB.Order("path")
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query = query.Where("path ILIKE ?", "%"+escapeLike(q)+"%")
+	}
+
+	var subjects []models.Subject
+	if err := query.Find(&subjects).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch subjects"})
+	}
+
+	if c.QueryBool("tree") {
+		return c.JSON(subjectTree(subjects))
+	}
+	return c.JSON(subjects)
+}
+
+func (h *SubjectHandler) GetSubject(c *fiber.Ctx) error {
+	var subject models.Subject
+	if err := h.DB.Preload("Children", func(db *gorm.DB) *gorm.DB {
+		return db.Order("name")
+	}).First(&subject, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Subject not found"})
+	}
+
+	return c.JSON(subject)
+}
+
+func (h *SubjectHandler) CreateSubject(c *fiber.Ctx) error {
+	var input subjectInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	var subject models.Subject
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := input.apply(tx, &subject); err != nil {
+			return err
+		}
+		return tx.Create(&subject).Error
+	})
+	if err != nil {
+		return subjectSaveFailed(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(subject)
+}
+
+// UpdateSubject renames or moves a subject, updating the paths of the
+// subjects beneath it to match.
+func (h *SubjectHandler) UpdateSubject(c *fiber.Ctx) error {
+	var input subjectInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	var subject models.Subject
+	if err := h.DB.First(&subject, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Subject not found"})
+	}
+
+	oldPrefix := subject.Path + models.SubjectPathSeparator
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := input.apply(tx, &subject); err != nil {
+			return err
+		}
+		if err := tx.Model(&subject).Select("parent_id", "name", "path").Updates(&subject).Error; err != nil {
+			return err
+		}
+
+		// Descendants keep their own names under the new path
+		newPrefix := subject.Path + models.SubjectPathSeparator
+		if err := tx.Model(&models.Subject{}).
+			Where("left(path, ?) = ?", utf8.RuneCountInString(oldPrefix), oldPrefix).
+			Update("path", gorm.Expr("? || substr(path, ?)", newPrefix, utf8.RuneCountInString(oldPrefix)+1)).Error; err != nil {
+			return err
+		}
+
+		// Tutors are found by the names of their subjects
+		return models.RefreshTutorSearch(tx, tx.Table("tutor_subjects").
+			Select("tutor_subjects.tutor_id").
+			Joins("JOIN subjects ON subjects.id = tutor_subjects.subject_id").
+			Where("subjects.id = ? OR left(subjects.path, ?) = ?", subject.ID, utf8.RuneCountInString(newPrefix), newPrefix))
+	})
+	if err != nil {
+		return subjectSaveFailed(c, err)
+	}
+
+	return c.JSON(subject)
+}
+
+// DeleteSubject removes a subject nobody uses. Subjects with children, or
+// that tutors or students have chosen, answer 409.
+func (h *SubjectHandler) DeleteSubject(c *fiber.Ctx) error {
+	var subject models.Subject
+	if err := h.DB.First(&subject, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Subject not found"})
+	}
+
+	var children, tutors, students int64
+	h.DB.Model(&models.Subject{}).Where("parent_id = ?", subject.ID).Count(&children)
+	h.DB.Model(&models.TutorSubject{}).Where("subject_id = ?", subject.ID).Count(&tutors)
+	h.DB.Model(&models.StudentSubject{}).Where("subject_id = ?", subject.ID).Count(&students)
+	if children > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Subject has subjects beneath it"})
+	}
+	if tutors > 0 || students > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Subject is in use by tutors or students"})
+	}
+
+	if err := h.DB.Delete(&subject).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete subject"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// subjectInput is the body for creating or replacing a subject. A nil
+// ParentID puts the subject at the top of the catalogue.
+type subjectInput struct {
+	Name     string `json:"name"`
+	ParentID *uint  `json:"parentId"`
+}
+
+// badSubjectError is an invalid subject, reported to the client as is.
+type badSubjectError string
+
+func (e badSubjectError) Error() string {
+	return string(e)
+}
+
+// apply validates the input and copies it onto subject, working out its
+// new path.
+func (input subjectInput) apply(tx *gorm.DB, subject *models.Subject) error {
+	name := strings.Join(strings.Fields(input.Name), " ")
+	if name == "" || utf8.RuneCountInString(name) > maxSubjectName {
+		return badSubjectError(fmt.Sprintf("name is required and must be at most %d characters", maxSubjectName))
+	}
+	if strings.Contains(name, ">") {
+		return badSubjectError(`name must not contain ">"`)
+	}
+
+	path := name
+	if input.ParentID != nil {
+		var parent models.Subject
+		if err := tx.First(&parent, *input.ParentID).Error; err != nil {
+			return badSubjectError("Parent subject not found")
+		}
+		// A subject cannot move beneath itself
+		if subject.ID != 0 && (parent.ID == subject.ID || strings.HasPrefix(parent.Path, subject.Path+models.SubjectPathSeparator)) {
+			return badSubjectError("A subject cannot be moved beneath itself")
+		}
+		path = parent.Path + models.SubjectPathSeparator + name
+	}
+
+	var count int64
+	if err := tx.Model(&models.Subject{}).Where("lower(path) = lower(?) AND id <> ?", path, subject.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errSubjectExists
+	}
+
+	subject.Name = name
+	subject.ParentID = input.ParentID
+	subject.Path = path
+	return nil
+}
+
+func subjectSaveFailed(c *fiber.Ctx, err error) error {
+	var bad badSubjectError
+	switch {
+	case errors.As(err, &bad):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": bad.Error()})
+	case errors.Is(err, errSubjectExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A subject with that name already exists there"})
+	}
+	log.Printf("Error saving subject: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save subject"})
+}
+
+// subjectTree nests subjects under their parents and returns the ones
+// whose parent is not in the list, such as the top of the catalogue.
+func subjectTree(subjects []models.Subject) []models.Subject {
+	listed := make(map[uint]bool, len(subjects))
+	for _, s := range subjects {
+		listed[s.ID] = true
+	}
+
+	children := make(map[uint][]models.Subject)
+	var roots []models.Subject
+	for _, s := range subjects {
+		if s.ParentID == nil || !listed[*s.ParentID] {
+			roots = append(roots, s)
+		} else {
+			children[*s.ParentID] = append(children[*s.ParentID], s)
+		}
+	}
+
+	var attach func(nodes []models.Subject)
+	attach = func(nodes []models.Subject) {
+		for i := range nodes {
+			nodes[i].Children = children[nodes[i].ID]
+			attach(nodes[i].Children)
+		}
+	}
+	attach(roots)
+
+	return roots
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// GetTutorSubjects lists the subjects a tutor teaches.
+func (h *TutorHandler) GetTutorSubjects(c *fiber.Ctx) error {
+	var tutor models.Tutor
+	if err := h.DB.First(&tutor, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tutor not found"})
+	}
+
+	var subjects []models.TutorSubject
+	if err := profileSubjects(h.DB, "tutor_subjects", "tutor_id", tutor.ID).Find(&subjects).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch subjects"})
+	}
+
+	return c.JSON(fiber.Map{"subjects": subjects})
+}
+
+// SetTutorSubjects replaces the subjects a tutor teaches.
+func (h *TutorHandler) SetTutorSubjects(c *fiber.Ctx) error {
+	var input struct {
+		Subjects []struct {
+			SubjectID  uint   `json:"subjectId"`
+			HourlyRate *int64 `json:"hourlyRate"`
+			Level      string `json:"level"`
+		} `json:"subjects"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	tutor, err := h.findOwnTutor(c)
+	if tutor == nil {
+		return err
+	}
+
+	ids := make([]uint, len(input.Subjects))
+	subjects := make([]models.TutorSubject, len(input.Subjects))
+	for i, s := range input.Subjects {
+		if s.HourlyRate != nil && *s.HourlyRate <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "hourlyRate must be a positive amount in minor currency units"})
+		}
+		ids[i] = s.SubjectID
+		subjects[i] = models.TutorSubject{TutorID: tutor.ID, SubjectID: s.SubjectID, HourlyRate: s.HourlyRate, Level: strings.TrimSpace(s.Level)}
+	}
+	if msg := checkProfileSubjects(h.DB, ids); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tutor_id = ?", tutor.ID).Delete(&models.TutorSubject{}).Error; err != nil {
+			return err
+		}
+		if len(subjects) > 0 {
+			if err := tx.Omit("Subject").Create(&subjects).Error; err != nil {
+				return err
+			}
+		}
+		return models.RefreshTutorSearch(tx, []uint{tutor.ID})
+	})
+	if err != nil {
+		log.Printf("Error saving subjects for tutor %d: %v", tutor.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save subjects"})
+	}
+
+	return h.GetTutorSubjects(c)
+}
+
+// GetStudentSubjects lists the subjects a student studies. Like the
+// profile itself, they are visible to the student, their tutors and admins.
+func (h *StudentHandler) GetStudentSubjects(c *fiber.Ctx) error {
+	var student models.Student
+	if err := h.DB.First(&student, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Student not found"})
+	}
+
+	if !canViewStudent(h.DB, middleware.CurrentUser(c), student.UserID) {
+		return policy.Forbidden(c)
+	}
+
+	var subjects []models.StudentSubject
+	if err := profileSubjects(h.DB, "student_subjects", "student_id", student.ID).Find(&subjects).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch subjects"})
+	}
+
+	return c.JSON(fiber.Map{"subjects": subjects})
+}
+
+// SetStudentSubjects replaces the subjects a student studies.
+func (h *StudentHandler) SetStudentSubjects(c *fiber.Ctx) error {
+	var input struct {
+		Subjects []struct {
+			SubjectID uint   `json:"subjectId"`
+			Level     string `json:"level"`
+		} `json:"subjects"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	var student models.Student
+	if err := h.DB.First(&student, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Student not found"})
+	}
+	if !policy.IsOwnerOrAdmin(middleware.CurrentUser(c), student.UserID) {
+		return policy.Forbidden(c)
+	}
+
+	ids := make([]uint, len(input.Subjects))
+	subjects := make([]models.StudentSubject, len(input.Subjects))
+	for i, s := range input.Subjects {
+		ids[i] = s.SubjectID
+		subjects[i] = models.StudentSubject{StudentID: student.ID, SubjectID: s.SubjectID, Level: strings.TrimSpace(s.Level)}
+	}
+	if msg := checkProfileSubjects(h.DB, ids); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("student_id = ?", student.ID).Delete(&models.StudentSubject{}).Error; err != nil {
+			return err
+		}
+		if len(subjects) == 0 {
+			return nil
+		}
+		return tx.Omit("Subject").Create(&subjects).Error
+	})
+	if err != nil {
+		log.Printf("Error saving subjects for student %d: %v", student.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save subjects"})
+	}
+
+	return h.GetStudentSubjects(c)
+}
+
+// profileSubjects queries a profile's links to the catalogue, with their
+// subjects, ordered by subject path.
+func profileSubjects(db *gorm.DB, table, column string, id uint) *gorm.DB {
+	return db.Joins("Subject").
+		Where(table+"."+column+" = ?", id).
+		Order(`"Subject"."path"`)
+}
+
+// checkProfileSubjects returns an error message unless ids name distinct
+// subjects in the catalogue.
+func checkProfileSubjects(db *gorm.DB, ids []uint) string {
+	if len(ids) > maxProfileSubjects {
+		return fmt.Sprintf("At most %d subjects are allowed", maxProfileSubjects)
+	}
+	if len(ids) == 0 {
+		return ""
+	}
+
+	distinct := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		distinct[id] = true
+	}
+	if len(distinct) != len(ids) {
+		return "Each subject may only be listed once"
+	}
+
+	var count int64
+	if err := db.Model(&models.Subject{}).Where("id IN ?", ids).Count(&count).Error; err != nil || count != int64(len(ids)) {
+		return "Unknown subject"
+	}
+	return ""
+}
+
+// subjectRate returns the tutor's hourly rate for a subject in minor
+// currency units: the rate set for the catalogue subject of that name if
+// there is one, otherwise the tutor's usual rate.
+func subjectRate(db *gorm.DB, tutor *models.Tutor, subject string) float64 {
+	var link models.TutorSubject
+	err := db.Joins("Subject").
+		Where("tutor_subjects.tutor_id = ? AND lower(\"Subject\".\"path\") = lower(?) AND tutor_subjects.hourly_rate IS NOT NULL", tutor.ID, subject).
+		First(&link).Error
+	if err == nil {
+		return float64(*link.HourlyRate)
+	}
+	return tutor.HourlyRate * 100
+}
@@ -1,41 +1,71 @@
 package handlers
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/OPTIC7409/tutor-api/internal/geocode"
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
 	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/policy"
+	"github.com/OPTIC7409/tutor-api/internal/scheduling"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxHeadline = 255
+	maxBio      = 5000
 )
 
 type TutorHandler struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Geocoder geocode.Geocoder
 }
 
-func NewTutorHandler(db *gorm.DB) *TutorHandler {
-	return &TutorHandler{DB: db}
+func NewTutorHandler(db *gorm.DB, geocoder geocode.Geocoder) *TutorHandler {
+	return &TutorHandler{DB: db, Geocoder: geocoder}
 }
 
 func (h *TutorHandler) CreateTutor(c *fiber.Ctx) error {
-	var tutor models.Tutor
-	if err := c.BodyParser(&tutor); err != nil {
+	var input tutorInput
+	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	result := h.DB.Create(&tutor)
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create tutor"})
+	// Admins may create profiles on behalf of another user
+	user := middleware.CurrentUser(c)
+	tutor := models.Tutor{UserID: user.ID}
+	if policy.IsAdmin(user) && input.UserID != 0 {
+		tutor.UserID = input.UserID
 	}
+	input.apply(&tutor)
 
-	return c.Status(fiber.StatusCreated).JSON(tutor)
-}
+	if !validTimeZone(&tutor) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown time zone " + strconv.Quote(tutor.TimeZone)})
+	}
+	if msg := checkTutorText(&tutor); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if msg := checkTutorTravel(&tutor); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	tutor.Latitude, tutor.Longitude = geolocate(c, h.Geocoder, tutor.Location)
 
-func (h *TutorHandler) GetTutors(c *fiber.Ctx) error {
-	var tutors []models.Tutor
-	result := h.DB.Preload("User").Find(&tutors)
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch tutors"})
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&tutor).Error; err != nil {
+			return err
+		}
+		return models.RefreshTutorSearch(tx, []uint{tutor.ID})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create tutor"})
 	}
 
-	return c.JSON(tutors)
+	return c.Status(fiber.StatusCreated).JSON(tutor)
 }
 
 func (h *TutorHandler) GetTutor(c *fiber.Ctx) error {
@@ -56,20 +86,132 @@ func (h *TutorHandler) UpdateTutor(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tutor not found"})
 	}
 
-	if err := c.BodyParser(&tutor); err != nil {
+	if !policy.IsOwnerOrAdmin(middleware.CurrentUser(c), tutor.UserID) {
+		return policy.Forbidden(c)
+	}
+
+	var input tutorInput
+	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	location := tutor.Location
+	input.apply(&tutor)
+
+	if !validTimeZone(&tutor) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown time zone " + strconv.Quote(tutor.TimeZone)})
+	}
+	if msg := checkTutorText(&tutor); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if msg := checkTutorTravel(&tutor); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if tutor.Location != location || tutor.Latitude == nil {
+		tutor.Latitude, tutor.Longitude = geolocate(c, h.Geocoder, tutor.Location)
+	}
 
-	h.DB.Save(&tutor)
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(&tutor).Error; err != nil {
+			return err
+		}
+		return models.RefreshTutorSearch(tx, []uint{tutor.ID})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update tutor"})
+	}
 	return c.JSON(tutor)
 }
 
 func (h *TutorHandler) DeleteTutor(c *fiber.Ctx) error {
 	id := c.Params("id")
-	result := h.DB.Delete(&models.Tutor{}, id)
+	var tutor models.Tutor
+	if err := h.DB.First(&tutor, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tutor not found"})
+	}
+
+	if !policy.IsOwnerOrAdmin(middleware.CurrentUser(c), tutor.UserID) {
+		return policy.Forbidden(c)
+	}
+
+	result := h.DB.Delete(&tutor)
 	if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete tutor"})
 	}
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
+
+// tutorInput holds the profile fields a tutor may set. The rest, such as
+// ratings from reviews and coordinates from the geocoder, are the server's.
+// Fields left out of an update keep their values.
+type tutorInput struct {
+	UserID          uint     `json:"userId"` // Admins only, when creating a profile for someone else
+	Subject         *string  `json:"subject"`
+	Headline        *string  `json:"headline"`
+	Bio             *string  `json:"bio"`
+	YearsExperience *int     `json:"yearsExperience"`
+	HourlyRate      *float64 `json:"hourlyRate"`
+	Location        *string  `json:"location"`
+	TimeZone        *string  `json:"timeZone"`
+	TravelRadiusKm  *float64 `json:"travelRadiusKm"`
+	LessonMode      *string  `json:"lessonMode"`
+}
+
+func (input tutorInput) apply(tutor *models.Tutor) {
+	setIfPresent(&tutor.Subject, input.Subject)
+	setIfPresent(&tutor.Headline, input.Headline)
+	setIfPresent(&tutor.Bio, input.Bio)
+	setIfPresent(&tutor.YearsExperience, input.YearsExperience)
+	setIfPresent(&tutor.HourlyRate, input.HourlyRate)
+	setIfPresent(&tutor.Location, input.Location)
+	setIfPresent(&tutor.TimeZone, input.TimeZone)
+	setIfPresent(&tutor.TravelRadiusKm, input.TravelRadiusKm)
+	setIfPresent(&tutor.LessonMode, input.LessonMode)
+}
+
+// setIfPresent copies *value to field unless value is nil.
+func setIfPresent[T any](field *T, value *T) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+// checkTutorText trims the tutor's headline and bio and returns an error
+// message if either is too long.
+func checkTutorText(tutor *models.Tutor) string {
+	tutor.Headline = strings.TrimSpace(tutor.Headline)
+	tutor.Bio = strings.TrimSpace(tutor.Bio)
+	if utf8.RuneCountInString(tutor.Headline) > maxHeadline {
+		return fmt.Sprintf("Headline must be at most %d characters", maxHeadline)
+	}
+	if utf8.RuneCountInString(tutor.Bio) > maxBio {
+		return fmt.Sprintf("Bio must be at most %d characters", maxBio)
+	}
+	return ""
+}
+
+// checkTutorTravel defaults an empty lesson mode to both and returns an
+// error message if the mode or travel radius is invalid.
+func checkTutorTravel(tutor *models.Tutor) string {
+	switch tutor.LessonMode {
+	case "":
+		tutor.LessonMode = models.LessonModeBoth
+	case models.LessonModeOnline, models.LessonModeInPerson, models.LessonModeBoth:
+	default:
+		return "LessonMode must be online, in_person or both"
+	}
+	if tutor.TravelRadiusKm < 0 || tutor.TravelRadiusKm > maxTravelRadiusKm {
+		return fmt.Sprintf("TravelRadiusKm must be from 0 to %d", maxTravelRadiusKm)
+	}
+	return ""
+}
+
+// validTimeZone defaults an empty time zone to UTC and reports whether the
+// tutor's time zone is a known IANA name.
+func validTimeZone(tutor *models.Tutor) bool {
+	if tutor.TimeZone == "" {
+		tutor.TimeZone = "UTC"
+	}
+	_, err := scheduling.LoadLocation(tutor.TimeZone)
+	return err == nil
+}
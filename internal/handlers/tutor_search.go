@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// tutorSort is an order for search results. Ties are broken by ID in the
+// same direction, so a cursor can resume after any row.
+type tutorSort struct {
+	column string
+	desc   bool
+	value  func(t *models.Tutor) float64 // Nil when ordering by ID alone
+}
+
+var tutorSorts = map[string]tutorSort{
+	"newest":     {column: "tutors.id", desc: true},
+	"price":      {column: "tutors.hourly_rate", value: func(t *models.Tutor) float64 { return t.HourlyRate }},
+	"-price":     {column: "tutors.hourly_rate", desc: true, value: func(t *models.Tutor) float64 { return t.HourlyRate }},
+	"rating":     {column: "tutors.rating_average", desc: true, value: func(t *models.Tutor) float64 { return t.RatingAverage }},
+	"experience": {column: "tutors.years_experience", desc: true, value: func(t *models.Tutor) float64 { return float64(t.YearsExperience) }},
+	"distance":   {column: "tutors.distance_km", value: func(t *models.Tutor) float64 { return *t.DistanceKm }},
+}
+
+// searchCursor marks the last result of a page: its sort value and ID.
+type searchCursor struct {
+	Sort  string  `json:"s"`
+	Value float64 `json:"v"`
+	ID    uint    `json:"id"`
+}
+
+func (cur searchCursor) encode() string {
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSearchCursor(s string) (searchCursor, bool) {
+	var cur searchCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &cur) != nil {
+		return cur, false
+	}
+	return cur, true
+}
+
+// GetTutors searches tutor profiles. Results are filtered by the query
+// string, sorted by sort and returned a page at a time: pass nextCursor
+// back as cursor, with the same filters and sort, for the following page.
+// total counts every match, not just the page. A near search gives each
+// tutor's DistanceKm and may sort by distance.
+func (h *TutorHandler) GetTutors(c *fiber.Ctx) error {
+	sortName := c.Query("sort", "newest")
+	sort, ok := tutorSorts[sortName]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "sort must be one of newest, price, -price, rating, experience and distance"})
+	}
+	if sortName == "distance" && c.Query("near") == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "sort=distance needs near"})
+	}
+	limit := c.QueryInt("limit", defaultSearchLimit)
+	if limit < 1 || limit > maxSearchLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be from 1 to 100"})
+	}
+
+	query, msg, err := h.filterTutors(c, h.DB)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err != nil {
+		log.Printf("Error filtering tutors: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to search tutors"})
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to search tutors"})
+	}
+
+	direction, after := " ASC", ">"
+	if sort.desc {
+		direction, after = " DESC", "<"
+	}
+	page := query
+	if s := c.Query("cursor"); s != "" {
+		cur, ok := decodeSearchCursor(s)
+		if !ok || cur.Sort != sortName {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cursor is invalid or from a search with a different sort"})
+		}
+		if sort.value == nil {
+			page = page.Where("tutors.id "+after+" ?", cur.ID)
+		} else {
+			page = page.Where("("+sort.column+", tutors.id) "+after+" (?, ?)", cur.Value, cur.ID)
+		}
+	}
+	if sort.value != nil {
+		page = page.Order(sort.column + direction)
+	}
+
+	var tutors []models.Tutor
+	if err := page.Order("tutors.id" + direction).Limit(limit + 1).Preload("User").Find(&tutors).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to search tutors"})
+	}
+
+	response := fiber.Map{"total": total}
+	if len(tutors) > limit {
+		tutors = tutors[:limit]
+		last := &tutors[limit-1]
+		cur := searchCursor{Sort: sortName, ID: last.ID}
+		if sort.value != nil {
+			cur.Value = sort.value(last)
+		}
+		response["nextCursor"] = cur.encode()
+	}
+	if tutors == nil {
+		tutors = []models.Tutor{}
+	}
+	response["tutors"] = tutors
+
+	return c.JSON(response)
+}
+
+// filterTutors builds a query on db from the filters in the query string.
+// It returns an error message if they are invalid, and an error if the
+// database fails while checking availability.
+func (h *TutorHandler) filterTutors(c *fiber.Ctx, db *gorm.DB) (*gorm.DB, string, error) {
+	query := db.Model(&models.Tutor{})
+
+	if id := c.Query("subjectId"); id != "" {
+		// A subject matches everything beneath it, so Maths finds GCSE tutors
+		var subject models.Subject
+		if err := h.DB.First(&subject, id).Error; err != nil {
+			return nil, "Unknown subject", nil
+		}
+		prefix := subject.Path + models.SubjectPathSeparator
+		query = query.Where("tutors.id IN (?)", h.DB.Table("tutor_subjects").
+			Select("tutor_subjects.tutor_id").
+			Joins("JOIN subjects ON subjects.id = tutor_subjects.subject_id").
+			Where("subjects.id = ? OR left(subjects.path, ?) = ?", subject.ID, utf8.RuneCountInString(prefix), prefix))
+	}
+	if subject := strings.TrimSpace(c.Query("subject")); subject != "" {
+		pattern := "%" + escapeLike(subject) + "%"
+		query = query.Where("(tutors.subject ILIKE ? OR tutors.id IN (?))", pattern, h.DB.Table("tutor_subjects").
+			Select("tutor_subjects.tutor_id").
+			Joins("JOIN subjects ON subjects.id = tutor_subjects.subject_id").
+			Where("subjects.path ILIKE ?", pattern))
+	}
+	if location := strings.TrimSpace(c.Query("location")); location != "" {
+		query = query.Where("tutors.location ILIKE ?", "%"+escapeLike(location)+"%")
+	}
+	if mode := c.Query("mode"); mode != "" {
+		if mode != models.LessonModeOnline && mode != models.LessonModeInPerson {
+			return nil, "mode must be online or in_person", nil
+		}
+		query = query.Where("tutors.lesson_mode IN ?", []string{mode, models.LessonModeBoth})
+	}
+
+	for _, bound := range []struct {
+		key, condition, msg string
+		max                 float64
+	}{
+		{"minPrice", "tutors.hourly_rate >= ?", "minPrice must not be negative", math.MaxFloat64},
+		{"maxPrice", "tutors.hourly_rate <= ?", "maxPrice must not be negative", math.MaxFloat64},
+		{"minExperience", "tutors.years_experience >= ?", "minExperience must not be negative", math.MaxFloat64},
+		{"minRating", "tutors.rating_count > 0 AND tutors.rating_average >= ?", "minRating must be from 0 to 5", 5},
+	} {
+		s := c.Query(bound.key)
+		if s == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil || value < 0 || value > bound.max {
+			return nil, bound.msg, nil
+		}
+		query = query.Where(bound.condition, value)
+	}
+
+	if c.Query("near") != "" {
+		point, radius, msg := parseNear(c, h.DB)
+		if msg != "" {
+			return nil, msg, nil
+		}
+		query = nearTutors(db, query, point, radius)
+	}
+
+	if c.Query("availableFrom") != "" || c.Query("availableTo") != "" {
+		now := time.Now()
+		from, to, length, msg := parseAvailabilityQuery(c, "availableFrom", "availableTo", middleware.CurrentUser(c).Location(), now)
+		if msg != "" {
+			return nil, msg, nil
+		}
+
+		ids, err := h.availableTutors(query.Session(&gorm.Session{}), from, to, length, now)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where("tutors.id IN ?", ids)
+	}
+
+	return query.Session(&gorm.Session{}), "", nil
+}
+
+// availableTutors returns the IDs of the tutors matched by query who have a
+// free slot of the given length between from and to.
+func (h *TutorHandler) availableTutors(query *gorm.DB, from, to time.Time, length time.Duration, now time.Time) ([]uint, error) {
+	var candidates []models.Tutor
+	if err := query.Select("tutors.id, tutors.user_id, tutors.time_zone").Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	free, err := tutorFreeTime(h.DB, candidates, from, to, now)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []uint{}
+	for _, t := range candidates {
+		for _, interval := range free[t.ID] {
+			if interval.End.Sub(interval.Start) >= length {
+				ids = append(ids, t.ID)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+const (
+	maxSearchQuery = 200
+	// searchSimilarity is how alike, from 0 to 1, a misspelt query must be
+	// to a tutor's name, subjects and headline to match them
+	searchSimilarity = "0.4"
+)
+
+// tutorMatch is a full-text search result: the tutor, how well they
+// matched and an excerpt of their headline and bio with the matching words
+// marked.
+type tutorMatch struct {
+	models.Tutor
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// SearchTutors finds the tutors whose name, subjects, headline or bio
+// match q, best first. Words are stemmed and any of them may match, so
+// "a-level chemistry organic" also finds A-Level Chemistry tutors who never
+// mention organic chemistry, ranked below those who do. Misspelt words
+// match by trigram similarity. The filters of GetTutors apply too, and a
+// near search gives each tutor's DistanceKm.
+func (h *TutorHandler) SearchTutors(c *fiber.Ctx) error {
+	q := strings.Join(strings.Fields(c.Query("q")), " ")
+	if q == "" || utf8.RuneCountInString(q) > maxSearchQuery {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("q is required and must be at most %d characters", maxSearchQuery)})
+	}
+	limit := c.QueryInt("limit", defaultSearchLimit)
+	if limit < 1 || limit > maxSearchLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be from 1 to 100"})
+	}
+	var cur *searchCursor
+	if s := c.Query("cursor"); s != "" {
+		decoded, ok := decodeSearchCursor(s)
+		if !ok || decoded.Sort != "relevance" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cursor is invalid or from a different search"})
+		}
+		cur = &decoded
+	}
+
+	var total int64
+	var matches []struct {
+		ID         uint
+		Rank       float64
+		Snippet    string
+		DistanceKm *float64
+	}
+	distance := ""
+	if c.Query("near") != "" {
+		distance = ", distance_km"
+	}
+	var msg string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// The <% operator matches at this similarity for this transaction only
+		if err := tx.Exec("SET LOCAL pg_trgm.word_similarity_threshold = " + searchSimilarity).Error; err != nil {
+			return err
+		}
+
+		query, invalid, err := h.filterTutors(c, tx)
+		if msg = invalid; msg != "" || err != nil {
+			return err
+		}
+
+		// Any word may match; more and rarer matches rank higher
+		ranked := query.
+			Joins("CROSS JOIN (SELECT replace(plainto_tsquery('english', ?)::text, ' & ', ' | ')::tsquery AS query, ?::text AS text) AS search", q, q).
+			Select(`tutors.id, tutors.headline, tutors.bio, search.query` + distance + `,
+				(coalesce(ts_rank_cd(tutors.search_document, search.query, 32), 0) + word_similarity(search.text, tutors.search_text))::float8 AS rank`).
+			Where("(tutors.search_document @@ search.query OR search.text <% tutors.search_text)")
+
+		if err := tx.Table("(?) AS ranked", ranked).Count(&total).Error; err != nil {
+			return err
+		}
+
+		// Snippets are escaped before highlighting, so they are safe to show as HTML
+		page := tx.Table("(?) AS ranked", ranked).
+			Select(`ranked.id, ranked.rank` + distance + `, ts_headline('english',
+				replace(replace(replace(concat_ws(' - ', nullif(ranked.headline, ''), nullif(ranked.bio, '')), '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+				ranked.query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MinWords=8, MaxWords=25') AS snippet`)
+		if cur != nil {
+			page = page.Where("(ranked.rank, ranked.id) < (?, ?)", cur.Value, cur.ID)
+		}
+		return page.Order("ranked.rank DESC, ranked.id DESC").Limit(limit + 1).Scan(&matches).Error
+	})
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	if err != nil {
+		log.Printf("Error searching tutors for %q: %v", q, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to search tutors"})
+	}
+
+	response := fiber.Map{"total": total}
+	if len(matches) > limit {
+		matches = matches[:limit]
+		last := matches[limit-1]
+		response["nextCursor"] = searchCursor{Sort: "relevance", Value: last.Rank, ID: last.ID}.encode()
+	}
+
+	ids := make([]uint, len(matches))
+	for i, m := range matches {
+		ids[i] = m.ID
+	}
+	var tutors []models.Tutor
+	if len(ids) > 0 {
+		if err := h.DB.Preload("User").Find(&tutors, ids).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to search tutors"})
+		}
+	}
+	byID := make(map[uint]models.Tutor, len(tutors))
+	for _, t := range tutors {
+		byID[t.ID] = t
+	}
+
+	results := make([]tutorMatch, 0, len(matches))
+	for _, m := range matches {
+		if t, ok := byID[m.ID]; ok {
+			t.DistanceKm = m.DistanceKm
+			results = append(results, tutorMatch{Tutor: t, Rank: m.Rank, Snippet: m.Snippet})
+		}
+	}
+	response["tutors"] = results
+
+	return c.JSON(response)
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/totp"
+	"github.com/OPTIC7409/tutor-api/internal/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	totpIssuer        = "Tutor API"
+	recoveryCodeCount = 10
+)
+
+// EnrollTwoFactor generates a new TOTP secret and recovery codes. Two-factor
+// only becomes active once ConfirmTwoFactor accepts a code from the app.
+func (h *AuthHandler) EnrollTwoFactor(c *fiber.Ctx) error {
+	var user models.User
+	if err := h.DB.First(&user, middleware.CurrentUser(c).ID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if user.TOTPEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is already enabled"})
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to enroll two-factor authentication"})
+	}
+
+	codes, hashed, err := generateRecoveryCodes(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to enroll two-factor authentication"})
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&hashed).Error
+	})
+	if err != nil {
+		log.Printf("Error enrolling two-factor for user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to enroll two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":        secret,
+		"otpauthUri":    totp.URI(totpIssuer, user.Email, secret),
+		"recoveryCodes": codes,
+	})
+}
+
+func (h *AuthHandler) ConfirmTwoFactor(c *fiber.Ctx) error {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, middleware.CurrentUser(c).ID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if user.TOTPEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is already enabled"})
+	}
+	if user.TOTPSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Start enrollment first"})
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, input.Code, time.Now())
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid code"})
+	}
+
+	if err := h.DB.Model(&user).Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to enable two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Two-factor authentication enabled"})
+}
+
+func (h *AuthHandler) DisableTwoFactor(c *fiber.Ctx) error {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, middleware.CurrentUser(c).ID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if !user.TOTPEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Two-factor authentication is not enabled"})
+	}
+
+	// Wrong codes count against the account as at login, so a stolen access
+	// token cannot be used to guess them
+	if throttled, err := h.loginThrottled(c, user.Email); throttled {
+		return err
+	}
+	if !h.consumeTOTPCode(&user, input.Code) {
+		h.loginFailed(c, user.Email, &user)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid code"})
+	}
+	h.loginSucceeded(c, user.Email)
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to disable two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
+
+// LoginMFA completes a login that was answered with an MFA challenge, using
+// either an authenticator code or a recovery code.
+func (h *AuthHandler) LoginMFA(c *fiber.Ctx) error {
+	var input struct {
+		MFAToken     string `json:"mfaToken"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+		DeviceName   string `json:"deviceName"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	claims, err := utils.ParseMFAToken(h.Keys, input.MFAToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired MFA token"})
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, claims.UserID).Error; err != nil || user.TokenVersion != claims.TokenVersion {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired MFA token"})
+	}
+
+	if throttled, err := h.loginThrottled(c, user.Email); throttled {
+		return err
+	}
+
+	var verified bool
+	if input.RecoveryCode != "" {
+		verified = h.consumeRecoveryCode(&user, input.RecoveryCode)
+	} else {
+		verified = h.consumeTOTPCode(&user, input.Code)
+	}
+	if !verified {
+		h.loginFailed(c, user.Email, &user)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid code"})
+	}
+
+	h.loginSucceeded(c, user.Email)
+
+	tokens, err := h.issueTokens(c, &user, input.DeviceName)
+	if err != nil {
+		log.Printf("Error issuing tokens for user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+
+	return c.JSON(tokens)
+}
+
+// mfaChallenge is returned by login instead of tokens when the account has
+// two-factor authentication enabled.
+func (h *AuthHandler) mfaChallenge(c *fiber.Ctx, user *models.User) error {
+	mfaToken, err := utils.GenerateMFAToken(h.Keys, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+
+	return c.JSON(fiber.Map{
+		"mfaRequired": true,
+		"mfaToken":    mfaToken,
+		"expiresIn":   int(utils.MFATokenTTL.Seconds()),
+	})
+}
+
+// consumeTOTPCode validates code and records its step so the same code
+// cannot be used twice.
+func (h *AuthHandler) consumeTOTPCode(user *models.User, code string) bool {
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false
+	}
+
+	result := h.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+func (h *AuthHandler) consumeRecoveryCode(user *models.User, code string) bool {
+	code = normalizeRecoveryCode(code)
+
+	var codes []models.RecoveryCode
+	if err := h.DB.Where("user_id = ? AND used_at IS NULL", user.ID).Find(&codes).Error; err != nil {
+		return false
+	}
+
+	for _, candidate := range codes {
+		if !candidate.Matches(code) {
+			continue
+		}
+
+		result := h.DB.Model(&candidate).Where("used_at IS NULL").Update("used_at", time.Now())
+		return result.Error == nil && result.RowsAffected == 1
+	}
+	return false
+}
+
+// generateRecoveryCodes returns the plaintext codes to show the user once
+// and their hashed counterparts to store.
+func generateRecoveryCodes(userID uint) ([]string, []models.RecoveryCode, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashed := make([]models.RecoveryCode, recoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = raw[:4] + "-" + raw[4:]
+
+		hash, err := models.HashPassword(normalizeRecoveryCode(codes[i]))
+		if err != nil {
+			return nil, nil, err
+		}
+		hashed[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+
+	return codes, hashed, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"strconv"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
 	"github.com/OPTIC7409/tutor-api/internal/models"
-	"github.com/OPTIC7409/tutor-api/internal/utils"
+	"github.com/OPTIC7409/tutor-api/internal/scheduling"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
@@ -16,12 +20,7 @@ func NewUserHandler(db *gorm.DB) *UserHandler {
 }
 
 func (h *UserHandler) GetDashboardData(c *fiber.Ctx) error {
-	userID, err := utils.ExtractUserIDFromToken(c, h.DB)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": err.Error(),
-		})
-	}
+	userID := int(middleware.CurrentUser(c).ID)
 
 	var user models.User
 	if err := h.DB.First(&user, userID).Error; err != nil {
@@ -36,8 +35,9 @@ func (h *UserHandler) GetDashboardData(c *fiber.Ctx) error {
 	dashboardData.Email = user.Email
 	dashboardData.UserType = user.UserType
 
+	loc := scheduling.LocationOrUTC(user.TimeZone)
 	if user.UserType == "tutor" {
-		tutorData, err := h.GetTutorDashboardData(userID)
+		tutorData, err := h.GetTutorDashboardData(userID, loc)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to fetch tutor data",
@@ -46,7 +46,7 @@ func (h *UserHandler) GetDashboardData(c *fiber.Ctx) error {
 		dashboardData.Stats = tutorData.Stats
 		dashboardData.Requests = tutorData.Requests
 	} else {
-		studentData, err := h.GetStudentDashboardData(userID)
+		studentData, err := h.GetStudentDashboardData(userID, loc)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to fetch student data",
@@ -66,26 +66,38 @@ func (h *UserHandler) GetDashboardData(c *fiber.Ctx) error {
 	return c.JSON(dashboardData)
 }
 
-func (h *UserHandler) GetTutorDashboardData(tutorID int) (*models.DashboardData, error) {
+// GetTutorDashboardData returns a tutor's stats, counting earnings by
+// calendar month in loc.
+func (h *UserHandler) GetTutorDashboardData(tutorID int, loc *time.Location) (*models.DashboardData, error) {
 	var tutorData models.DashboardData
 
 	// Fetch tutor stats
+	now := time.Now().In(loc)
 	var stats models.TutorStats
-	if err := h.DB.Table("sessions").
-		Select("COUNT(DISTINCT student_id) as active_students, COUNT(*) as upcoming_sessions, SUM(price) as earnings_this_month").
-		Where("tutor_id = ? AND start_time > NOW() AND start_time < DATE_ADD(NOW(), INTERVAL 1 MONTH)", tutorID).
+	if err := h.DB.Model(&models.Session{}).
+		Select("COUNT(DISTINCT student_id) AS active_students, COUNT(*) AS upcoming_sessions").
+		Where("tutor_id = ? AND status = ? AND start_time > ?", tutorID, models.SessionConfirmed, now).
 		Scan(&stats).Error; err != nil {
 		return nil, err
 	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	if err := h.DB.Model(&models.Session{}).
+		Select("COALESCE(SUM(price), 0)").
+		Where("tutor_id = ? AND status = ? AND start_time >= ? AND start_time < ?",
+			tutorID, models.SessionCompleted, monthStart, monthStart.AddDate(0, 1, 0)).
+		Scan(&stats.EarningsThisMonth).Error; err != nil {
+		return nil, err
+	}
 	tutorData.Stats = &stats
 
-	// Fetch tutor requests
+	// Fetch requests waiting on the tutor
 	var requests []models.Request
 	if err := h.DB.Table("requests").
-		Select("requests.id, users.name as student, subjects.name as subject, requests.budget, users.avatar").
+		Select("requests.id, users.name as student, requests.subject, requests.budget, requests.currency").
 		Joins("JOIN users ON requests.student_id = users.id").
-		Joins("JOIN subjects ON requests.subject_id = subjects.id").
-		Where("requests.tutor_id = ? AND requests.status = ?", tutorID, "pending").
+		Where("requests.tutor_id = ? AND requests.status = ?", tutorID, models.RequestPending).
+		Order("requests.created_at").
 		Scan(&requests).Error; err != nil {
 		return nil, err
 	}
@@ -94,21 +106,34 @@ func (h *UserHandler) GetTutorDashboardData(tutorID int) (*models.DashboardData,
 	return &tutorData, nil
 }
 
-func (h *UserHandler) GetStudentDashboardData(studentID int) (*models.DashboardData, error) {
+// GetStudentDashboardData returns a student's upcoming sessions, with
+// times in loc.
+func (h *UserHandler) GetStudentDashboardData(studentID int, loc *time.Location) (*models.DashboardData, error) {
 	var studentData models.DashboardData
 
-	// Fetch upcoming sessions
+	// Fetch upcoming sessions, showing each series once as its next occurrence
+	now := time.Now()
+	statuses := []string{models.SessionRequested, models.SessionConfirmed}
 	var upcomingSessions []models.UpcomingSession
 	if err := h.DB.Table("sessions").
-		Select("users.name as tutor, subjects.name as subject, sessions.start_time as datetime").
+		Select(`sessions.id, users.name AS tutor, sessions.subject, sessions.start_time AS datetime, sessions.status,
+			sessions.series_id, session_series.frequency,
+			(SELECT COUNT(*) FROM sessions later WHERE later.series_id = sessions.series_id
+				AND later.status IN ? AND later.start_time > ?) AS remaining`, statuses, now).
 		Joins("JOIN users ON sessions.tutor_id = users.id").
-		Joins("JOIN subjects ON sessions.subject_id = subjects.id").
-		Where("sessions.student_id = ? AND sessions.start_time > NOW()", studentID).
+		Joins("LEFT JOIN session_series ON sessions.series_id = session_series.id").
+		Where("sessions.student_id = ? AND sessions.status IN ? AND sessions.start_time > ?", studentID, statuses, now).
+		Where(`sessions.series_id IS NULL OR sessions.id = (SELECT upcoming.id FROM sessions upcoming
+			WHERE upcoming.series_id = sessions.series_id AND upcoming.status IN ? AND upcoming.start_time > ?
+			ORDER BY upcoming.start_time LIMIT 1)`, statuses, now).
 		Order("sessions.start_time ASC").
 		Limit(5).
 		Scan(&upcomingSessions).Error; err != nil {
 		return nil, err
 	}
+	for i := range upcomingSessions {
+		upcomingSessions[i].Datetime = upcomingSessions[i].Datetime.In(loc)
+	}
 	studentData.UpcomingSessions = upcomingSessions
 
 	return &studentData, nil
@@ -117,14 +142,34 @@ func (h *UserHandler) GetStudentDashboardData(studentID int) (*models.DashboardD
 func (h *UserHandler) GetUserChats(userID int) ([]models.Chat, error) {
 	var chats []models.Chat
 
-	if err := h.DB.Table("chats").
-		Select("chats.id, users.name, messages.content as last_message, users.avatar").
-		Joins("JOIN users ON CASE WHEN chats.user1_id = ? THEN chats.user2_id = users.id ELSE chats.user1_id = users.id END", userID).
-		Joins("LEFT JOIN messages ON chats.id = messages.chat_id AND messages.id = (SELECT MAX(id) FROM messages WHERE chat_id = chats.id)").
-		Where("chats.user1_id = ? OR chats.user2_id = ?", userID, userID).
-		Scan(&chats).Error; err != nil {
+	if err := h.DB.Preload("Participants").
+		Joins("JOIN chat_participants ON chat_participants.chat_id = chats.id").
+		Where("chat_participants.user_id = ?", userID).
+		Find(&chats).Error; err != nil {
 		return nil, err
 	}
 
 	return chats, nil
 }
+
+// SetTimeZone changes the time zone the caller's times are shown in.
+func (h *UserHandler) SetTimeZone(c *fiber.Ctx) error {
+	var input struct {
+		TimeZone string `json:"timeZone"`
+	}
+
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	if _, err := scheduling.LoadLocation(input.TimeZone); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown time zone " + strconv.Quote(input.TimeZone)})
+	}
+
+	if err := h.DB.Model(&models.User{}).Where("id = ?", middleware.CurrentUser(c).ID).
+		Update("time_zone", input.TimeZone).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update time zone"})
+	}
+
+	return c.JSON(fiber.Map{"timeZone": input.TimeZone})
+}
@@ -0,0 +1,238 @@
+// Package ical writes iCalendar (RFC 5545) files for calendar apps.
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Event statuses.
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+const (
+	dateTimeFormat = "20060102T150405"
+	productID      = "-//Tutor API//Sessions//EN"
+	maxLineLength  = 75
+)
+
+// Event is a VEVENT. UID must stay the same for the life of the event and
+// Sequence must grow whenever it changes, so calendar apps update their
+// copy instead of adding another one. Start and End are written as local
+// times in Location, or in UTC when it is nil.
+type Event struct {
+	UID          string
+	Sequence     int
+	Summary      string
+	Description  string
+	Status       string
+	Start        time.Time
+	End          time.Time
+	Location     *time.Location
+	Created      time.Time
+	LastModified time.Time
+}
+
+// Calendar is a VCALENDAR holding events.
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Marshal encodes the calendar, with a VTIMEZONE for every time zone its
+// events use. now is written as every event's DTSTAMP.
+func (c *Calendar) Marshal(now time.Time) []byte {
+	w := &writer{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:" + productID)
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	if c.Name != "" {
+		w.line("X-WR-CALNAME:" + escape(c.Name))
+	}
+
+	for _, zone := range c.zones() {
+		writeTimeZone(w, zone.loc, zone.from, zone.to)
+	}
+
+	for _, e := range c.Events {
+		w.line("BEGIN:VEVENT")
+		w.line("UID:" + escape(e.UID))
+		w.line("DTSTAMP:" + utc(now))
+		w.line(dateTime("DTSTART", e.Start, e.Location))
+		w.line(dateTime("DTEND", e.End, e.Location))
+		w.line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+		w.line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			w.line("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.Status != "" {
+			w.line("STATUS:" + e.Status)
+		}
+		if !e.Created.IsZero() {
+			w.line("CREATED:" + utc(e.Created))
+		}
+		if !e.LastModified.IsZero() {
+			w.line("LAST-MODIFIED:" + utc(e.LastModified))
+		}
+		w.line("END:VEVENT")
+	}
+
+	w.line("END:VCALENDAR")
+	return w.buf.Bytes()
+}
+
+type zoneRange struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+// zones returns the time zones used by events, other than UTC, with the
+// span of time they are needed for.
+func (c *Calendar) zones() []zoneRange {
+	ranges := map[string]*zoneRange{}
+	for _, e := range c.Events {
+		if e.Location == nil || e.Location == time.UTC {
+			continue
+		}
+		r, ok := ranges[e.Location.String()]
+		if !ok {
+			r = &zoneRange{loc: e.Location, from: e.Start, to: e.End}
+			ranges[e.Location.String()] = r
+		}
+		if e.Start.Before(r.from) {
+			r.from = e.Start
+		}
+		if e.End.After(r.to) {
+			r.to = e.End
+		}
+	}
+
+	zones := make([]zoneRange, 0, len(ranges))
+	for _, r := range ranges {
+		zones = append(zones, *r)
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].loc.String() < zones[j].loc.String() })
+	return zones
+}
+
+// writeTimeZone writes a VTIMEZONE for loc covering [from, to]: the
+// observance in effect at from, then one per UTC offset change after it.
+func writeTimeZone(w *writer, loc *time.Location, from, to time.Time) {
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:" + loc.String())
+
+	start := from.In(loc)
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+	_, offset := start.Zone()
+	writeObservance(w, start, offset)
+
+	for day := start; day.Before(to); {
+		next := day.Add(24 * time.Hour)
+		if _, nextOffset := next.In(loc).Zone(); nextOffset != offset {
+			transition := findTransition(loc, day, next)
+			writeObservance(w, transition, offset)
+			offset = nextOffset
+		}
+		day = next
+	}
+
+	w.line("END:VTIMEZONE")
+}
+
+// writeObservance writes the STANDARD or DAYLIGHT component starting at t,
+// when the offset changes from fromOffset to the one in effect at t.
+func writeObservance(w *writer, t time.Time, fromOffset int) {
+	name, offset := t.Zone()
+	kind := "STANDARD"
+	if t.IsDST() {
+		kind = "DAYLIGHT"
+	}
+
+	w.line("BEGIN:" + kind)
+	// DTSTART is the wall-clock time of the change under the old offset
+	w.line("DTSTART:" + t.In(time.FixedZone("", fromOffset)).Format(dateTimeFormat))
+	w.line("TZOFFSETFROM:" + formatOffset(fromOffset))
+	w.line("TZOFFSETTO:" + formatOffset(offset))
+	w.line("TZNAME:" + escape(name))
+	w.line("END:" + kind)
+}
+
+// findTransition returns the first second in (before, after] whose UTC
+// offset in loc differs from the offset at before.
+func findTransition(loc *time.Location, before, after time.Time) time.Time {
+	_, offset := before.In(loc).Zone()
+	lo, hi := before.Unix(), after.Unix()
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if _, o := time.Unix(mid, 0).In(loc).Zone(); o == offset {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return time.Unix(hi, 0).In(loc)
+}
+
+func formatOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign = '-'
+		seconds = -seconds
+	}
+	s := fmt.Sprintf("%c%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		s += fmt.Sprintf("%02d", seconds%60)
+	}
+	return s
+}
+
+func dateTime(name string, t time.Time, loc *time.Location) string {
+	if loc == nil || loc == time.UTC {
+		return name + ":" + utc(t)
+	}
+	return name + ";TZID=" + loc.String() + ":" + t.In(loc).Format(dateTimeFormat)
+}
+
+func utc(t time.Time) string {
+	return t.UTC().Format(dateTimeFormat) + "Z"
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escape escapes a TEXT value. Every line break, including a bare CR, becomes
+// \n so a value can never end the content line early.
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+type writer struct {
+	buf bytes.Buffer
+}
+
+// line writes a content line ending in CRLF, folding it so no line is
+// longer than 75 octets and no UTF-8 character is split.
+func (w *writer) line(s string) {
+	limit := maxLineLength
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.buf.WriteString(s[:cut])
+		w.buf.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with the folding space
+		limit = maxLineLength - 1
+	}
+	w.buf.WriteString(s)
+	w.buf.WriteString("\r\n")
+}
@@ -0,0 +1,69 @@
+package loginguard
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// DatabaseStore keeps counters in the login_attempts table so every API
+// instance sees the same failures.
+type DatabaseStore struct {
+	DB *gorm.DB
+}
+
+func NewDatabaseStore(db *gorm.DB) *DatabaseStore {
+	return &DatabaseStore{DB: db}
+}
+
+func (s *DatabaseStore) Get(ctx context.Context, key string) (Attempts, error) {
+	var row models.LoginAttempt
+	err := s.DB.WithContext(ctx).Where("key = ?", key).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Attempts{}, nil
+	}
+	if err != nil {
+		return Attempts{}, err
+	}
+	return toAttempts(row), nil
+}
+
+func (s *DatabaseStore) RecordFailure(ctx context.Context, key string, now, resetBefore time.Time) (Attempts, error) {
+	var row models.LoginAttempt
+	err := s.DB.WithContext(ctx).Raw(`
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_attempts.last_failure_at < ?
+					AND (login_attempts.locked_until IS NULL OR login_attempts.locked_until <= EXCLUDED.last_failure_at)
+				THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING key, failures, last_failure_at, locked_until`,
+		key, now, resetBefore).Scan(&row).Error
+	if err != nil {
+		return Attempts{}, err
+	}
+	return toAttempts(row), nil
+}
+
+func (s *DatabaseStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return s.DB.WithContext(ctx).Model(&models.LoginAttempt{}).Where("key = ?", key).Update("locked_until", until).Error
+}
+
+func (s *DatabaseStore) Reset(ctx context.Context, key string) error {
+	return s.DB.WithContext(ctx).Where("key = ?", key).Delete(&models.LoginAttempt{}).Error
+}
+
+func toAttempts(row models.LoginAttempt) Attempts {
+	attempts := Attempts{Failures: row.Failures, LastFailure: row.LastFailureAt}
+	if row.LockedUntil != nil {
+		attempts.LockedUntil = *row.LockedUntil
+	}
+	return attempts
+}
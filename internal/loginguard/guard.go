@@ -0,0 +1,164 @@
+// Package loginguard throttles repeated failed logins. Failures are counted
+// per key (an account or a client IP) in a Store; after a few free attempts
+// every further failure doubles the wait before the next attempt, and a key
+// that keeps failing is locked out for a while.
+package loginguard
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Attempts is the failure state tracked for one key.
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists failure counters. Implementations must make RecordFailure
+// atomic so concurrent attempts are all counted.
+type Store interface {
+	Get(ctx context.Context, key string) (Attempts, error)
+	// RecordFailure counts a failure at now. Failures recorded before
+	// resetBefore are forgotten first.
+	RecordFailure(ctx context.Context, key string, now, resetBefore time.Time) (Attempts, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type Policy struct {
+	// FreeAttempts failures are allowed before backoff starts.
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// LockoutThreshold failures lock the key for LockoutDuration. Zero
+	// disables lockout.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// Window is how long failures are remembered.
+	Window time.Duration
+}
+
+// AccountPolicy protects a single account against password guessing.
+var AccountPolicy = Policy{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         5 * time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  30 * time.Minute,
+	Window:           24 * time.Hour,
+}
+
+// IPPolicy slows down a single client spraying many accounts.
+var IPPolicy = Policy{
+	FreeAttempts: 20,
+	BaseDelay:    time.Second,
+	MaxDelay:     15 * time.Minute,
+	Window:       time.Hour,
+}
+
+type Guard struct {
+	Store  Store
+	Policy Policy
+	// Now is the clock, replaceable in tests.
+	Now func() time.Time
+}
+
+func New(store Store, policy Policy) *Guard {
+	return &Guard{Store: store, Policy: policy, Now: time.Now}
+}
+
+// Check returns how long the caller must wait before key may attempt to log
+// in again, and whether the wait is due to a lockout.
+func (g *Guard) Check(ctx context.Context, key string) (wait time.Duration, locked bool, err error) {
+	attempts, err := g.Store.Get(ctx, key)
+	if err != nil {
+		return 0, false, err
+	}
+
+	now := g.Now()
+	if now.Before(attempts.LockedUntil) {
+		return attempts.LockedUntil.Sub(now), true, nil
+	}
+	if now.Sub(attempts.LastFailure) > g.Policy.Window {
+		return 0, false, nil
+	}
+
+	if next := attempts.LastFailure.Add(g.delay(attempts.Failures)); now.Before(next) {
+		return next.Sub(now), false, nil
+	}
+	return 0, false, nil
+}
+
+// Fail records a failed attempt for key and reports whether it locked the key.
+func (g *Guard) Fail(ctx context.Context, key string) (locked bool, err error) {
+	now := g.Now()
+	attempts, err := g.Store.RecordFailure(ctx, key, now, now.Add(-g.Policy.Window))
+	if err != nil {
+		return false, err
+	}
+
+	if g.Policy.LockoutThreshold == 0 || attempts.Failures < g.Policy.LockoutThreshold {
+		return false, nil
+	}
+
+	// Lock once per threshold crossing; further failures while locked are
+	// rejected by Check before they get here.
+	if now.Before(attempts.LockedUntil) {
+		return false, nil
+	}
+	if err := g.Store.Lock(ctx, key, now.Add(g.Policy.LockoutDuration)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Succeed clears the failures of key after a successful login.
+func (g *Guard) Succeed(ctx context.Context, key string) error {
+	return g.Store.Reset(ctx, key)
+}
+
+// Unlock lifts a lockout and forgets the failures of key.
+func (g *Guard) Unlock(ctx context.Context, key string) error {
+	return g.Store.Reset(ctx, key)
+}
+
+func (g *Guard) delay(failures int) time.Duration {
+	over := failures - g.Policy.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+
+	delay := g.Policy.BaseDelay
+	for i := 1; i < over; i++ {
+		delay *= 2
+		if delay >= g.Policy.MaxDelay {
+			return g.Policy.MaxDelay
+		}
+	}
+	return delay
+}
+
+// Limiter combines the per-account and per-IP guards used by the login
+// endpoints.
+type Limiter struct {
+	Accounts *Guard
+	IPs      *Guard
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{
+		Accounts: New(store, AccountPolicy),
+		IPs:      New(store, IPPolicy),
+	}
+}
+
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,21 @@
+package loginguard
+
+import (
+	"fmt"
+
+	"github.com/OPTIC7409/tutor-api/config"
+	"gorm.io/gorm"
+)
+
+// NewStore returns the Store selected by cfg.LoginAttemptStore. The database
+// store is the default so that counters are shared between instances.
+func NewStore(cfg *config.Config, db *gorm.DB) (Store, error) {
+	switch cfg.LoginAttemptStore {
+	case "database", "":
+		return NewDatabaseStore(db), nil
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown login attempt store %q", cfg.LoginAttemptStore)
+	}
+}
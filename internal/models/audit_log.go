@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	AuditAccountLocked   = "account_locked"
+	AuditAccountUnlocked = "account_unlocked"
+)
+
+// AuditLog records security relevant events for later review.
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    *uint     `gorm:"index" json:"userId"`
+	ActorID   *uint     `json:"actorId"`
+	Action    string    `gorm:"size:64;not null;index" json:"action"`
+	IPAddress string    `gorm:"size:64" json:"ipAddress"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"createdAt"`
+}
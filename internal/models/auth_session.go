@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// AuthSession is one logged-in device. Access tokens carry the session ID,
+// so revoking a session logs that device out without touching the others.
+type AuthSession struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"userId"`
+	DeviceName string     `gorm:"size:255" json:"deviceName"`
+	IPAddress  string     `gorm:"size:64" json:"ipAddress"`
+	UserAgent  string     `gorm:"size:512" json:"userAgent"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	RevokedAt  *time.Time `json:"-"`
+}
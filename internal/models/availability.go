@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// AvailabilityWindow is a weekly recurring span during which a tutor can be
+// booked, in the tutor's time zone. StartMinute and EndMinute count minutes
+// after local midnight.
+type AvailabilityWindow struct {
+	ID          uint `gorm:"primarykey" json:"id"`
+	TutorID     uint `gorm:"not null;index" json:"tutorId"`
+	Weekday     int  `gorm:"not null" json:"weekday"` // 0 is Sunday
+	StartMinute int  `gorm:"not null" json:"startMinute"`
+	EndMinute   int  `gorm:"not null" json:"endMinute"`
+}
+
+// AvailabilityException overrides the weekly windows for a one-off span:
+// a blackout such as a holiday, or extra availability when Available is set.
+type AvailabilityException struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	TutorID   uint      `gorm:"not null;index" json:"tutorId"`
+	StartTime time.Time `gorm:"not null" json:"startTime"`
+	EndTime   time.Time `gorm:"not null" json:"endTime"`
+	Available bool      `gorm:"not null;default:false" json:"available"`
+	Reason    string    `gorm:"size:255" json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Localize converts the exception's timestamps to loc.
+func (e *AvailabilityException) Localize(loc *time.Location) {
+	e.StartTime = e.StartTime.In(loc)
+	e.EndTime = e.EndTime.In(loc)
+	e.CreatedAt = e.CreatedAt.In(loc)
+}
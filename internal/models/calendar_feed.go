@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// CalendarFeed is a user's secret iCalendar subscription URL. Only the
+// SHA-256 hash of the token in the URL is stored.
+type CalendarFeed struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	UserID     uint       `gorm:"not null;uniqueIndex" json:"userId"`
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
@@ -1,5 +1,9 @@
 package models
 
+import (
+	"time"
+)
+
 type DashboardData struct {
 	ID               int               `json:"id"`
 	Name             string            `json:"name"`
@@ -11,22 +15,30 @@ type DashboardData struct {
 	Stats            *TutorStats       `json:"stats,omitempty"`
 }
 
+// Request is a pending tutoring request on the tutor dashboard.
 type Request struct {
-	ID      int    `json:"id"`
-	Student string `json:"student"`
-	Subject string `json:"subject"`
-	Budget  string `json:"budget"`
-	Avatar  string `json:"avatar"`
+	ID       uint   `json:"id"`
+	Student  string `json:"student"`
+	Subject  string `json:"subject"`
+	Budget   int64  `json:"budget"` // Hourly, in minor currency units
+	Currency string `json:"currency"`
 }
 
+// UpcomingSession is a session on the student dashboard. A series appears
+// once, as its next occurrence.
 type UpcomingSession struct {
-	Tutor    string `json:"tutor"`
-	Subject  string `json:"subject"`
-	Datetime string `json:"datetime"`
+	ID        uint      `json:"id"`
+	Tutor     string    `json:"tutor"`
+	Subject   string    `json:"subject"`
+	Datetime  time.Time `json:"datetime"` // Start time, in the student's time zone
+	Status    string    `json:"status"`
+	SeriesID  *uint     `json:"seriesId,omitempty"`
+	Frequency string    `json:"frequency,omitempty"`
+	Remaining int       `json:"remaining,omitempty"` // Upcoming occurrences in the series, including this one
 }
 
 type TutorStats struct {
-	ActiveStudents    int     `json:"activeStudents"`
-	UpcomingSessions  int     `json:"upcomingSessions"`
-	EarningsThisMonth float64 `json:"earningsThisMonth"`
+	ActiveStudents    int   `json:"activeStudents"`
+	UpcomingSessions  int   `json:"upcomingSessions"`
+	EarningsThisMonth int64 `json:"earningsThisMonth"` // Completed sessions, in minor currency units
 }
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// ExternalIdentity links a user to an account at an OpenID Connect provider.
+type ExternalIdentity struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"userId"`
+	Provider  string    `gorm:"size:64;not null;uniqueIndex:idx_external_identity" json:"provider"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_external_identity" json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// OIDCLoginState remembers an authorization request between the redirect
+// to the provider and its callback.
+type OIDCLoginState struct {
+	ID           uint      `gorm:"primarykey"`
+	StateHash    string    `gorm:"size:64;not null;uniqueIndex"`
+	Provider     string    `gorm:"size:64;not null"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	CreatedAt    time.Time
+}
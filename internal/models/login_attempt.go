@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginAttempt counts recent failed logins for one account or client IP.
+type LoginAttempt struct {
+	Key           string    `gorm:"primaryKey;size:320"`
+	Failures      int       `gorm:"not null"`
+	LastFailureAt time.Time `gorm:"not null"`
+	LockedUntil   *time.Time
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// Organisation is a partner such as a school whose systems integrate with
+// the API through API keys.
+type Organisation struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// APIKey lets an organisation's servers call the API without a login. The
+// key acts on behalf of the member who created it, limited to its scopes.
+// Only a hash of the secret is stored; Prefix identifies the key in logs
+// and listings.
+type APIKey struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	OrganisationID uint       `gorm:"not null;index" json:"organisationId"`
+	CreatedByID    uint       `gorm:"not null" json:"createdById"`
+	Name           string     `gorm:"size:255;not null" json:"name"`
+	Prefix         string     `gorm:"size:32;uniqueIndex;not null" json:"prefix"`
+	KeyHash        string     `gorm:"size:64;not null" json:"-"`
+	Scopes         []string   `gorm:"serializer:json;type:text;not null" json:"scopes"`
+	ExpiresAt      *time.Time `json:"expiresAt"`
+	LastUsedAt     *time.Time `json:"lastUsedAt"`
+	RevokedAt      *time.Time `json:"revokedAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// IsActive reports whether the key may still be used at now.
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
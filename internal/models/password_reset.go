@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordResetToken is a single-use token mailed to a user who forgot
+// their password. Only its hash is stored.
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primarykey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RecoveryCode is a single-use fallback for a lost authenticator. Codes are
+// bcrypt hashed like User.Password.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (r *RecoveryCode) Matches(code string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(r.CodeHash), []byte(code)) == nil
+}
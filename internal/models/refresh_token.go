@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken tracks the refresh token family of one AuthSession.
+// Each refresh rotates TokenHash; presenting an earlier token of the family
+// is treated as theft and revokes the whole family.
+type RefreshToken struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"userId"`
+	SessionID  uint       `gorm:"uniqueIndex" json:"sessionId"`
+	FamilyID   string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	TokenHash  string     `gorm:"size:64;not null" json:"-"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+func (t *RefreshToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
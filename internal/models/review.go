@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// ReviewSessionConstraint names the unique index allowing one review per
+// session.
+const ReviewSessionConstraint = "idx_reviews_session_id"
+
+// Review is a student's rating, from 1 to 5, of a completed session.
+// TutorID and StudentID are user IDs.
+type Review struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	SessionID   uint      `gorm:"not null;uniqueIndex" json:"sessionId"`
+	TutorID     uint      `gorm:"not null;index" json:"tutorId"`
+	StudentID   uint      `gorm:"not null" json:"studentId"`
+	StudentName string    `gorm:"->;-:migration" json:"studentName,omitempty"` // Read from users when listing reviews
+	Rating      int       `gorm:"not null" json:"rating"`
+	Comment     string    `gorm:"type:text" json:"comment"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
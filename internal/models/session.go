@@ -0,0 +1,111 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Session statuses. A session is requested by one party and confirmed by
+// the other; rescheduling sends it back to requested. A held session
+// reserves a slot while the student pays and becomes requested once they
+// have, or expired if they never do.
+const (
+	SessionHeld      = "held"
+	SessionExpired   = "expired"
+	SessionRequested = "requested"
+	SessionConfirmed = "confirmed"
+	SessionCancelled = "cancelled"
+	SessionCompleted = "completed"
+)
+
+// SessionHoldDuration is how long a held session reserves its slot.
+const SessionHoldDuration = 10 * time.Minute
+
+// ActiveSessionStatuses are the statuses that occupy the tutor's time. The
+// database rejects two active sessions for one tutor that overlap.
+var ActiveSessionStatuses = []string{SessionHeld, SessionRequested, SessionConfirmed}
+
+// SessionOverlapConstraint names the exclusion constraint on sessions.
+const SessionOverlapConstraint = "sessions_tutor_no_overlap"
+
+var ErrInvalidTransition = errors.New("invalid session status transition")
+
+// sessionTransitions lists the statuses each status may move to.
+var sessionTransitions = map[string][]string{
+	SessionHeld:      {SessionRequested, SessionCancelled, SessionExpired},
+	SessionRequested: {SessionRequested, SessionConfirmed, SessionCancelled},
+	SessionConfirmed: {SessionRequested, SessionCancelled, SessionCompleted},
+}
+
+// Session is a tutoring session between a tutor and a student. TutorID and
+// StudentID are user IDs. Price is in minor currency units (e.g. pence).
+type Session struct {
+	ID                 uint       `gorm:"primarykey" json:"id"`
+	TutorID            uint       `gorm:"not null;index" json:"tutorId"`
+	Tutor              User       `gorm:"foreignKey:TutorID" json:"tutor"`
+	StudentID          uint       `gorm:"not null;index" json:"studentId"`
+	Student            User       `gorm:"foreignKey:StudentID" json:"student"`
+	Subject            string     `gorm:"size:255;not null" json:"subject"`
+	StartTime          time.Time  `gorm:"not null;index" json:"startTime"`
+	EndTime            time.Time  `gorm:"not null" json:"endTime"`
+	Price              int64      `gorm:"not null" json:"price"`
+	Currency           string     `gorm:"size:3;not null;default:GBP" json:"currency"`
+	Status             string     `gorm:"size:16;not null;index" json:"status"`
+	SeriesID           *uint      `gorm:"index" json:"seriesId,omitempty"`
+	RequestedByID      uint       `gorm:"not null" json:"requestedById"` // Who proposed the current time; the other party confirms
+	HoldExpiresAt      *time.Time `json:"holdExpiresAt,omitempty"`
+	CancelledByID      *uint      `json:"cancelledById,omitempty"`
+	CancellationReason string     `json:"cancellationReason,omitempty"`
+	Sequence           int        `gorm:"not null;default:0" json:"-"` // Revision number for calendar exports, bumped on every change
+	CreatedAt          time.Time  `json:"createdAt"`
+	UpdatedAt          time.Time  `json:"updatedAt"`
+}
+
+// CanTransition reports whether the session may move to status.
+func (s *Session) CanTransition(status string) bool {
+	for _, allowed := range sessionTransitions[s.Status] {
+		if allowed == status {
+			return true
+		}
+	}
+	return false
+}
+
+// HoldExpired reports whether the session is a hold that lapsed before the
+// student completed the booking.
+func (s *Session) HoldExpired(now time.Time) bool {
+	return s.Status == SessionHeld && s.HoldExpiresAt != nil && !now.Before(*s.HoldExpiresAt)
+}
+
+// IsParticipant reports whether userID is the session's tutor or student.
+func (s *Session) IsParticipant(userID uint) bool {
+	return s.TutorID == userID || s.StudentID == userID
+}
+
+// Confirmer returns the user who must agree to a requested session: the
+// other side from whoever asked for it. Admins book on a student's behalf,
+// so sessions they request are for the tutor to confirm.
+func (s *Session) Confirmer() uint {
+	if s.RequestedByID == s.TutorID {
+		return s.StudentID
+	}
+	return s.TutorID
+}
+
+// Duration returns the length of the session.
+func (s *Session) Duration() time.Duration {
+	return s.EndTime.Sub(s.StartTime)
+}
+
+// Localize converts the session's timestamps to loc, so they are written
+// with that zone's offset.
+func (s *Session) Localize(loc *time.Location) {
+	s.StartTime = s.StartTime.In(loc)
+	s.EndTime = s.EndTime.In(loc)
+	s.CreatedAt = s.CreatedAt.In(loc)
+	s.UpdatedAt = s.UpdatedAt.In(loc)
+	if s.HoldExpiresAt != nil {
+		t := s.HoldExpiresAt.In(loc)
+		s.HoldExpiresAt = &t
+	}
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// Series frequencies.
+const (
+	SeriesWeekly   = "weekly"
+	SeriesBiweekly = "biweekly"
+)
+
+// MaxSeriesOccurrences caps how many sessions one series books.
+const MaxSeriesOccurrences = 52
+
+// SessionSeries books the same tutor at the same local time every week or
+// every other week. Each occurrence is materialised as a Session; StartTime
+// and EndTime are those of the first one. The series ends after Count
+// occurrences or at Until, whichever is set.
+type SessionSeries struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	TutorID       uint       `gorm:"not null;index" json:"tutorId"`
+	StudentID     uint       `gorm:"not null;index" json:"studentId"`
+	Subject       string     `gorm:"size:255;not null" json:"subject"`
+	StartTime     time.Time  `gorm:"not null" json:"startTime"`
+	EndTime       time.Time  `gorm:"not null" json:"endTime"`
+	TimeZone      string     `gorm:"size:64;not null" json:"timeZone"` // Occurrences keep their wall-clock time in this zone
+	Frequency     string     `gorm:"size:16;not null" json:"frequency"`
+	Count         *int       `json:"count,omitempty"`
+	Until         *time.Time `json:"until,omitempty"`
+	RequestedByID uint       `gorm:"not null" json:"requestedById"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+// IntervalWeeks returns the number of weeks between occurrences.
+func (s *SessionSeries) IntervalWeeks() int {
+	if s.Frequency == SeriesBiweekly {
+		return 2
+	}
+	return 1
+}
+
+// Localize converts the series' timestamps to loc.
+func (s *SessionSeries) Localize(loc *time.Location) {
+	s.StartTime = s.StartTime.In(loc)
+	s.EndTime = s.EndTime.In(loc)
+	s.CreatedAt = s.CreatedAt.In(loc)
+	s.UpdatedAt = s.UpdatedAt.In(loc)
+	if s.Until != nil {
+		t := s.Until.In(loc)
+		s.Until = &t
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// SigningKey is a private key used to sign access tokens. A key signs new
+// tokens from NotBefore until a newer key takes over, and is published for
+// verification until ExpiresAt.
+type SigningKey struct {
+	ID         uint      `gorm:"primarykey"`
+	Kid        string    `gorm:"size:64;uniqueIndex;not null"`
+	Algorithm  string    `gorm:"size:16;not null"`
+	PrivateKey string    `gorm:"not null" json:"-"` // PKCS #8, PEM encoded
+	NotBefore  time.Time `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	CreatedAt  time.Time
+}
@@ -6,9 +6,11 @@ import (
 
 type Student struct {
 	gorm.Model
-	UserID   uint   `gorm:"not null"`
-	User     User   `gorm:"foreignKey:UserID"`
-	Age      int    `gorm:"not null"`
-	Subjects string `gorm:"size:255;not null"`
-	Location string `gorm:"size:255;not null"`
+	UserID    uint     `gorm:"not null"`
+	User      User     `gorm:"foreignKey:UserID"`
+	Age       int      `gorm:"not null"`
+	Subjects  string   `gorm:"size:255;not null"` // Free text; catalogue subjects are StudentSubjects
+	Location  string   `gorm:"size:255;not null"`
+	Latitude  *float64 // Geocoded from Location; nil if it could not be found
+	Longitude *float64
 }
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// SubjectPathSeparator joins the names in a subject's Path.
+const SubjectPathSeparator = " > "
+
+// Subject is an entry in the subject catalogue. Subjects nest, so a
+// category such as Maths can hold levels such as GCSE and A-Level. Path
+// names the whole branch, e.g. "Maths > GCSE", and is unique.
+type Subject struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	ParentID  *uint     `gorm:"index" json:"parentId"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Path      string    `gorm:"size:512;not null;uniqueIndex" json:"path"`
+	Children  []Subject `gorm:"foreignKey:ParentID" json:"children,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TutorSubject links a tutor profile to a subject they teach. HourlyRate,
+// in minor currency units, replaces the tutor's usual rate for sessions in
+// the subject. Level is the tutor's own note, e.g. "up to A-Level".
+type TutorSubject struct {
+	TutorID    uint    `gorm:"primaryKey" json:"-"`
+	SubjectID  uint    `gorm:"primaryKey;index" json:"subjectId"`
+	Subject    Subject `json:"subject"`
+	HourlyRate *int64  `json:"hourlyRate,omitempty"`
+	Level      string  `gorm:"size:64" json:"level,omitempty"`
+}
+
+// StudentSubject links a student profile to a subject they study.
+type StudentSubject struct {
+	StudentID uint    `gorm:"primaryKey" json:"-"`
+	SubjectID uint    `gorm:"primaryKey;index" json:"subjectId"`
+	Subject   Subject `json:"subject"`
+	Level     string  `gorm:"size:64" json:"level,omitempty"`
+}
+
+// SplitSubjects parses a free-text list of subjects such as
+// "Maths, Physics; Design and Technology" into subject paths, each a list
+// of names from the top of the catalogue down; "Maths > GCSE" and
+// "Maths/GCSE" both name GCSE under Maths. Only commas, semicolons and
+// new lines separate subjects, since "and" and "&" appear in real names
+// such as "Business & Economics". Repeats are dropped, ignoring case.
+func SplitSubjects(text string) [][]string {
+	replacer := strings.NewReplacer(";", ",", "\n", ",", "/", ">")
+
+	var paths [][]string
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(replacer.Replace(text), ",") {
+		var names []string
+		for _, name := range strings.Split(item, ">") {
+			if name = strings.Join(strings.Fields(name), " "); name != "" {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+
+		key := strings.ToLower(strings.Join(names, SubjectPathSeparator))
+		if !seen[key] {
+			seen[key] = true
+			paths = append(paths, names)
+		}
+	}
+	return paths
+}
@@ -4,12 +4,55 @@ import (
 	"gorm.io/gorm"
 )
 
+// How a tutor teaches, their LessonMode
+const (
+	LessonModeOnline   = "online"
+	LessonModeInPerson = "in_person"
+	LessonModeBoth     = "both"
+)
+
 type Tutor struct {
 	gorm.Model
-	UserID          uint    `gorm:"not null"`
-	User            User    `gorm:"foreignKey:UserID"`
-	Subject         string  `gorm:"size:255;not null"`
-	YearsExperience int     `gorm:"not null"`
-	HourlyRate      float64 `gorm:"not null"`
-	Location        string  `gorm:"size:255;not null"`
+	UserID          uint     `gorm:"not null;index"`
+	User            User     `gorm:"foreignKey:UserID"`
+	Subject         string   `gorm:"size:255;not null"` // Free-text headline; catalogue subjects are TutorSubjects
+	Headline        string   `gorm:"size:255;not null;default:''"`
+	Bio             string   `gorm:"type:text;not null;default:''"`
+	YearsExperience int      `gorm:"not null;index"`
+	HourlyRate      float64  `gorm:"not null;index"`
+	Location        string   `gorm:"size:255;not null"`
+	Latitude        *float64 `gorm:"index:idx_tutors_coordinates"` // Geocoded from Location; nil if it could not be found
+	Longitude       *float64 `gorm:"index:idx_tutors_coordinates"`
+	TravelRadiusKm  float64  `gorm:"not null;default:0"`            // How far from Location the tutor will travel to teach in person
+	LessonMode      string   `gorm:"size:16;not null;default:both"` // online, in_person or both
+	TimeZone        string   `gorm:"size:64;not null;default:UTC"`  // IANA name, e.g. Europe/London
+	RatingAverage   float64  `gorm:"not null;default:0;index"`      // Mean of the tutor's reviews, kept up to date as they arrive
+	RatingCount     int      `gorm:"not null;default:0"`
+	DistanceKm      *float64 `gorm:"->;-:migration" json:",omitempty"` // From the point of a near search
+}
+
+// RefreshTutorSearch recomputes the full-text search columns of the tutors
+// whose IDs are in tutorIDs, a slice or a subquery. The document weights
+// the tutor's name and subjects above their headline, and the headline
+// above their bio; search_text holds the short fields for typo-tolerant
+// trigram matching. Call it whenever any of them change.
+func RefreshTutorSearch(db *gorm.DB, tutorIDs interface{}) error {
+	return db.Exec(`UPDATE tutors SET
+		search_document =
+			setweight(to_tsvector('english', src.name), 'A') ||
+			setweight(to_tsvector('english', tutors.subject || ' ' || src.paths), 'A') ||
+			setweight(to_tsvector('english', tutors.headline), 'B') ||
+			setweight(to_tsvector('english', tutors.bio), 'C'),
+		search_text = concat_ws(' ', src.name, tutors.subject, src.paths, tutors.headline)
+	FROM (
+		SELECT t.id, coalesce(u.name, '') AS name,
+			coalesce(string_agg(replace(s.path, ?, ' '), ' '), '') AS paths
+		FROM tutors t
+		JOIN users u ON u.id = t.user_id
+		LEFT JOIN tutor_subjects ts ON ts.tutor_id = t.id
+		LEFT JOIN subjects s ON s.id = ts.subject_id
+		WHERE t.id IN (?)
+		GROUP BY t.id, u.name
+	) AS src
+	WHERE tutors.id = src.id`, SubjectPathSeparator, tutorIDs).Error
 }
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+)
+
+// Tutoring request statuses. A request is pending until a tutor accepts,
+// declines or counters it; a counter-offer waits for the student.
+const (
+	RequestPending   = "pending"
+	RequestCountered = "countered"
+	RequestAccepted  = "accepted"
+	RequestDeclined  = "declined"
+	RequestWithdrawn = "withdrawn"
+)
+
+// requestTransitions lists the statuses each status may move to.
+var requestTransitions = map[string][]string{
+	RequestPending:   {RequestCountered, RequestAccepted, RequestDeclined, RequestWithdrawn},
+	RequestCountered: {RequestAccepted, RequestDeclined, RequestWithdrawn},
+}
+
+// TimeRange is a span of time a student would like a session in.
+type TimeRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// TutoringRequest is a student asking for tutoring, either from one tutor
+// or, with no TutorID, on the open board for any tutor to take; the tutor
+// who counters or accepts an open request becomes its TutorID. TutorID and
+// StudentID are user IDs. Budget and CounterRate are hourly rates in minor
+// currency units.
+type TutoringRequest struct {
+	ID             uint        `gorm:"primarykey" json:"id"`
+	StudentID      uint        `gorm:"not null;index" json:"studentId"`
+	Student        User        `gorm:"foreignKey:StudentID" json:"student"`
+	TutorID        *uint       `gorm:"index" json:"tutorId"`
+	Tutor          *User       `gorm:"foreignKey:TutorID" json:"tutor,omitempty"`
+	Subject        string      `gorm:"size:255;not null" json:"subject"`
+	Budget         int64       `gorm:"not null" json:"budget"`
+	Currency       string      `gorm:"size:3;not null;default:GBP" json:"currency"`
+	PreferredTimes []TimeRange `gorm:"serializer:json;type:text" json:"preferredTimes"`
+	Message        string      `gorm:"type:text" json:"message"`
+	Status         string      `gorm:"size:16;not null;index" json:"status"`
+	CounterRate    *int64      `json:"counterRate,omitempty"`
+	CounterMessage string      `gorm:"type:text" json:"counterMessage,omitempty"`
+	ChatID         *uint       `json:"chatId,omitempty"`
+	SessionID      *uint       `json:"sessionId,omitempty"`
+	CreatedAt      time.Time   `json:"createdAt"`
+	UpdatedAt      time.Time   `json:"updatedAt"`
+}
+
+// TableName keeps the table the dashboard has always read from.
+func (TutoringRequest) TableName() string {
+	return "requests"
+}
+
+// CanTransition reports whether the request may move to status.
+func (r *TutoringRequest) CanTransition(status string) bool {
+	for _, allowed := range requestTransitions[r.Status] {
+		if allowed == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOpen reports whether the request is on the open board.
+func (r *TutoringRequest) IsOpen() bool {
+	return r.TutorID == nil
+}
+
+// AgreedRate returns the hourly rate the request would be accepted at:
+// the tutor's counter-offer if there is one, otherwise the student's budget.
+func (r *TutoringRequest) AgreedRate() int64 {
+	if r.CounterRate != nil {
+		return *r.CounterRate
+	}
+	return r.Budget
+}
+
+// Localize converts the request's timestamps to loc.
+func (r *TutoringRequest) Localize(loc *time.Location) {
+	for i := range r.PreferredTimes {
+		r.PreferredTimes[i].Start = r.PreferredTimes[i].Start.In(loc)
+		r.PreferredTimes[i].End = r.PreferredTimes[i].End.In(loc)
+	}
+	r.CreatedAt = r.CreatedAt.In(loc)
+	r.UpdatedAt = r.UpdatedAt.In(loc)
+}
+
+// PrefersTime reports whether start to end is one of the student's
+// preferred times.
+func (r *TutoringRequest) PrefersTime(start, end time.Time) bool {
+	for _, t := range r.PreferredTimes {
+		if t.Start.Equal(start) && t.End.Equal(end) {
+			return true
+		}
+	}
+	return false
+}
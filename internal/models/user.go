@@ -7,26 +7,89 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	UserTypeStudent = "student"
+	UserTypeTutor   = "tutor"
+	UserTypeAdmin   = "admin"
+)
+
+// UserEmailConstraint names the unique index on users.email.
+const UserEmailConstraint = "idx_users_email"
+
+// Roles within an organisation. Only its admins manage its API keys.
+const (
+	OrganisationRoleMember = "member"
+	OrganisationRoleAdmin  = "admin"
+)
+
+// IsValidUserType reports whether t is one of the known roles.
+func IsValidUserType(t string) bool {
+	switch t {
+	case UserTypeStudent, UserTypeTutor, UserTypeAdmin:
+		return true
+	}
+	return false
+}
+
 type User struct {
-	ID        uint      `gorm:"primarykey" json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `gorm:"uniqueIndex" json:"email"`
-	Password  string    `json:"-"`
-	UserType  string    `json:"userType"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
-	Token     string    `json:"-"` // New field to store the token
+	ID               uint       `gorm:"primarykey" json:"id"`
+	Name             string     `json:"name"`
+	Email            string     `gorm:"uniqueIndex" json:"email"`
+	Password         string     `json:"-"`
+	UserType         string     `json:"userType"`
+	OrganisationID   *uint      `gorm:"index" json:"organisationId"`
+	OrganisationRole string     `gorm:"size:16;not null;default:''" json:"organisationRole,omitempty"`
+	TimeZone         string     `gorm:"size:64;not null;default:UTC" json:"timeZone"` // IANA name; times are shown to the user in it
+	EmailVerifiedAt  *time.Time `json:"emailVerifiedAt"`
+	PendingEmail     string     `json:"pendingEmail,omitempty"`
+	TOTPSecret       string     `json:"-"`
+	TOTPEnabled      bool       `gorm:"not null;default:false" json:"totpEnabled"`
+	TOTPLastStep     int64      `json:"-"` // Last accepted step, so a code cannot be replayed
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+	TokenVersion     int        `gorm:"not null;default:0" json:"-"` // Incremented to revoke every issued token
+
+	storedPassword string // Hash last read from or written to the database
 }
 
-func (u *User) BeforeCreate(tx *gorm.DB) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+// BeforeSave hashes the password whenever it was set since the user was
+// loaded, on create as well as on later saves. Whatever the value looks
+// like it is treated as plaintext, so a client cannot store a hash of its
+// choosing. Re-saving a loaded user leaves the stored hash alone, and an
+// empty value (e.g. a partial update) is left alone too.
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	if u.Password == "" || u.Password == u.storedPassword {
+		return nil
+	}
+
+	hashedPassword, err := HashPassword(u.Password)
 	if err != nil {
 		return err
 	}
-	u.Password = string(hashedPassword)
+	u.Password = hashedPassword
+	u.storedPassword = hashedPassword
 	return nil
 }
 
+// AfterFind remembers the stored hash so BeforeSave can tell it apart from
+// a new password.
+func (u *User) AfterFind(tx *gorm.DB) error {
+	u.storedPassword = u.Password
+	return nil
+}
+
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+func HashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
 func (u *User) ComparePassword(password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 }
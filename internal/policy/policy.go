@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"github.com/OPTIC7409/tutor-api/internal/middleware"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/scope"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Forbidden writes the 403 response shared by every authorization check.
+func Forbidden(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You do not have permission to perform this action"})
+}
+
+// RequireRole only lets callers with one of the given user types through.
+// It must be mounted after middleware.Protected.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := middleware.CurrentUser(c)
+		if user == nil || !HasRole(user, roles...) {
+			return Forbidden(c)
+		}
+		return c.Next()
+	}
+}
+
+// RequireVerifiedEmail blocks callers who have not verified their email
+// address yet. It must be mounted after middleware.Protected.
+func RequireVerifiedEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := middleware.CurrentUser(c)
+		if user == nil || !user.EmailVerified {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Please verify your email address first"})
+		}
+		return c.Next()
+	}
+}
+
+// RequireScope only lets callers through whose token or API key carries
+// every one of scopes. It must be mounted after middleware.Protected.
+func RequireScope(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := middleware.CurrentUser(c)
+		if user == nil || !HasScopes(user, scopes...) {
+			return Forbidden(c)
+		}
+		return c.Next()
+	}
+}
+
+func HasScopes(user *middleware.AuthUser, scopes ...string) bool {
+	for _, s := range scopes {
+		if !scope.Contains(user.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func HasRole(user *middleware.AuthUser, roles ...string) bool {
+	for _, role := range roles {
+		if user.UserType == role {
+			return true
+		}
+	}
+	return false
+}
+
+func IsAdmin(user *middleware.AuthUser) bool {
+	return user.UserType == models.UserTypeAdmin
+}
+
+// IsOwnerOrAdmin reports whether user owns a resource belonging to ownerID,
+// or is an admin who may act on anyone's behalf.
+func IsOwnerOrAdmin(user *middleware.AuthUser, ownerID uint) bool {
+	return user.ID == ownerID || IsAdmin(user)
+}
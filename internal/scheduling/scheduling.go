@@ -0,0 +1,217 @@
+// Package scheduling computes bookable time slots from weekly availability,
+// one-off exceptions and existing bookings.
+//
+// Weekly windows are wall-clock times in the tutor's time zone, so a window
+// from 09:00 to 17:00 stays 09:00 to 17:00 local time across daylight saving
+// changes even though its UTC offset moves. A window spanning the transition
+// itself is as long as the wall clock says: one hour shorter when clocks go
+// forward and one hour longer when they go back.
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Interval is a half-open span of time [Start, End).
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Window is a weekly recurring span of local time. Start and End are minutes
+// after local midnight; End may be 24*60.
+type Window struct {
+	Weekday time.Weekday
+	Start   int
+	End     int
+}
+
+// Expand returns the occurrences of windows in loc that overlap [from, to),
+// clipped to it.
+func Expand(windows []Window, loc *time.Location, from, to time.Time) []Interval {
+	var intervals []Interval
+
+	// Start a day early so windows running past midnight are not missed
+	first := from.In(loc)
+	day := time.Date(first.Year(), first.Month(), first.Day()-1, 0, 0, 0, 0, loc)
+	for !day.After(to) {
+		for _, w := range windows {
+			if w.Weekday != day.Weekday() {
+				continue
+			}
+
+			// time.Date resolves the local wall clock, including the hour
+			// skipped or repeated by a daylight saving transition
+			start := time.Date(day.Year(), day.Month(), day.Day(), 0, w.Start, 0, 0, loc)
+			end := time.Date(day.Year(), day.Month(), day.Day(), 0, w.End, 0, 0, loc)
+			if interval, ok := clip(Interval{start, end}, from, to); ok {
+				intervals = append(intervals, interval)
+			}
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc)
+	}
+
+	return Merge(intervals)
+}
+
+// Merge sorts intervals and joins the ones that overlap or touch.
+func Merge(intervals []Interval) []Interval {
+	if len(intervals) == 0 {
+		return nil
+	}
+
+	sorted := append([]Interval(nil), intervals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	merged := []Interval{sorted[0]}
+	for _, interval := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if interval.Start.After(last.End) {
+			merged = append(merged, interval)
+			continue
+		}
+		if interval.End.After(last.End) {
+			last.End = interval.End
+		}
+	}
+	return merged
+}
+
+// Subtract removes every busy interval from free.
+func Subtract(free, busy []Interval) []Interval {
+	busy = Merge(busy)
+
+	var result []Interval
+	for _, f := range Merge(free) {
+		current := f
+		for _, b := range busy {
+			if !b.End.After(current.Start) || !b.Start.Before(current.End) {
+				continue
+			}
+			if b.Start.After(current.Start) {
+				result = append(result, Interval{current.Start, b.Start})
+			}
+			current.Start = b.End
+			if !current.Start.Before(current.End) {
+				break
+			}
+		}
+		if current.Start.Before(current.End) {
+			result = append(result, current)
+		}
+	}
+	return result
+}
+
+// Slots splits free time into slots of the given length, starting every
+// step from the beginning of each free interval.
+func Slots(free []Interval, length, step time.Duration) []Interval {
+	var slots []Interval
+	for _, f := range free {
+		for start := f.Start; !start.Add(length).After(f.End); start = start.Add(step) {
+			slots = append(slots, Interval{start, start.Add(length)})
+		}
+	}
+	return slots
+}
+
+// Clip cuts intervals down to [from, to), dropping the ones outside it.
+func Clip(intervals []Interval, from, to time.Time) []Interval {
+	var result []Interval
+	for _, interval := range intervals {
+		if clipped, ok := clip(interval, from, to); ok {
+			result = append(result, clipped)
+		}
+	}
+	return result
+}
+
+func clip(interval Interval, from, to time.Time) (Interval, bool) {
+	if interval.Start.Before(from) {
+		interval.Start = from
+	}
+	if interval.End.After(to) {
+		interval.End = to
+	}
+	return interval, interval.Start.Before(interval.End)
+}
+
+// Recur returns start followed by its repeats every weeks weeks, keeping
+// start's wall-clock time in loc across daylight saving changes. It stops
+// after count occurrences or past until, whichever comes first. A zero count
+// or until is no limit, but with neither only start is returned. It never
+// returns more than max occurrences, so callers can tell a series that is
+// too long by asking for one more than they allow.
+func Recur(start time.Time, loc *time.Location, weeks, count int, until time.Time, max int) []time.Time {
+	if count == 0 && until.IsZero() {
+		count = 1
+	}
+	if count == 0 || count > max {
+		count = max
+	}
+
+	local := start.In(loc)
+	var occurrences []time.Time
+	for i := 0; i < count; i++ {
+		t := time.Date(local.Year(), local.Month(), local.Day()+7*weeks*i,
+			local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), loc)
+		if !until.IsZero() && t.After(until) {
+			break
+		}
+		occurrences = append(occurrences, t)
+	}
+	return occurrences
+}
+
+// locations caches loaded time zones, which are parsed from tzdata on
+// every time.LoadLocation call.
+var locations sync.Map
+
+// LoadLocation loads an IANA time zone such as "Europe/London". Unlike
+// time.LoadLocation it rejects "Local", which depends on the server.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// LocationOrUTC loads the time zone name, falling back to UTC for names
+// that are empty or unknown.
+func LocationOrUTC(name string) *time.Location {
+	loc, err := LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ParseClock parses a wall-clock time "HH:MM" into minutes after midnight.
+// "24:00" is accepted as the end of the day.
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err == nil {
+		return t.Hour()*60 + t.Minute(), nil
+	}
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+}
+
+// FormatClock is the inverse of ParseClock.
+func FormatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
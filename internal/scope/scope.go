@@ -0,0 +1,99 @@
+// Package scope defines the permissions carried by access tokens and granted
+// to API keys.
+package scope
+
+import (
+	"strings"
+
+	"github.com/OPTIC7409/tutor-api/internal/models"
+)
+
+const (
+	TutorsRead    = "tutors:read"
+	TutorsWrite   = "tutors:write"
+	StudentsRead  = "students:read"
+	StudentsWrite = "students:write"
+	ChatsRead     = "chats:read"
+	ChatsWrite    = "chats:write"
+	SessionsRead  = "sessions:read"
+	SessionsWrite = "sessions:write"
+	RequestsRead  = "requests:read"
+	RequestsWrite = "requests:write"
+	SubjectsRead  = "subjects:read"
+	DashboardRead = "dashboard:read"
+	Admin         = "admin"
+
+	// Account covers managing the account itself: sessions, two-factor,
+	// credentials, organisations and API keys. Only full logins have it.
+	Account = "account"
+)
+
+// All lists every known scope.
+var All = []string{
+	TutorsRead,
+	TutorsWrite,
+	StudentsRead,
+	StudentsWrite,
+	ChatsRead,
+	ChatsWrite,
+	SessionsRead,
+	SessionsWrite,
+	RequestsRead,
+	RequestsWrite,
+	SubjectsRead,
+	DashboardRead,
+	Admin,
+	Account,
+}
+
+func Valid(s string) bool {
+	for _, known := range All {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether granted includes s.
+func Contains(granted []string, s string) bool {
+	for _, g := range granted {
+		if g == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ForRole returns every scope a user of the given type may hold.
+func ForRole(userType string) []string {
+	scopes := []string{TutorsRead, StudentsRead, StudentsWrite, ChatsRead, ChatsWrite, SessionsRead, SessionsWrite, RequestsRead, RequestsWrite, SubjectsRead, DashboardRead, Account}
+	switch userType {
+	case models.UserTypeTutor:
+		scopes = append(scopes, TutorsWrite)
+	case models.UserTypeAdmin:
+		scopes = append(scopes, TutorsWrite, Admin)
+	}
+	return scopes
+}
+
+// Intersect returns the scopes of requested that are also in allowed.
+func Intersect(requested, allowed []string) []string {
+	var scopes []string
+	for _, s := range requested {
+		if Contains(allowed, s) && !Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// Parse splits a space separated scope claim.
+func Parse(claim string) []string {
+	return strings.Fields(claim)
+}
+
+// Format joins scopes into a space separated scope claim.
+func Format(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
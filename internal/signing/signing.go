@@ -0,0 +1,338 @@
+// Package signing manages the asymmetric keys access tokens are signed with.
+// Keys live in the database so every instance signs with the same key, are
+// rotated on a schedule and published as a JWKS so other services can verify
+// tokens without sharing a secret.
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/jwk"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+
+	// refreshInterval is how often the manager reloads keys from the
+	// database and checks whether a rotation is due.
+	refreshInterval = time.Minute
+
+	// rotationLockID is the Postgres advisory lock held while rotating.
+	rotationLockID = 7409012
+)
+
+// Options configure a KeyManager.
+type Options struct {
+	Algorithm string
+	// RotationInterval is how long each key signs tokens.
+	RotationInterval time.Duration
+	// PublishAhead is how long a new key is published before it starts
+	// signing, so verifiers that cache the JWKS already know it.
+	PublishAhead time.Duration
+	// VerifyGrace is how long a key is still published after it stopped
+	// signing. It must exceed the lifetime of the tokens it signed.
+	VerifyGrace time.Duration
+}
+
+type KeyManager struct {
+	DB      *gorm.DB
+	Options Options
+
+	mu   sync.RWMutex
+	keys []*signingKey // ordered by NotBefore, oldest first
+}
+
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	notBefore time.Time
+	expiresAt time.Time
+}
+
+// NewKeyManager loads the stored keys, creating the first one if needed.
+func NewKeyManager(db *gorm.DB, opts Options) (*KeyManager, error) {
+	if _, err := signingMethod(opts.Algorithm); err != nil {
+		return nil, err
+	}
+
+	m := &KeyManager{DB: db, Options: opts}
+	if err := m.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Run reloads the keys and rotates them on schedule until ctx is cancelled.
+func (m *KeyManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Refresh(ctx); err != nil {
+				log.Printf("Error refreshing signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// Refresh creates the next key once the newest one is due to be replaced
+// and reloads the published keys from the database.
+func (m *KeyManager) Refresh(ctx context.Context) error {
+	now := time.Now()
+	err := m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Instances refresh concurrently; only one of them may rotate
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", rotationLockID).Error; err != nil {
+			return err
+		}
+
+		var newest []models.SigningKey
+		if err := tx.Where("algorithm = ? AND expires_at > ?", m.Options.Algorithm, now).
+			Order("not_before DESC").Limit(1).Find(&newest).Error; err != nil {
+			return err
+		}
+
+		var notBefore time.Time
+		switch {
+		case len(newest) == 0 || !newest[0].NotBefore.Add(m.Options.RotationInterval).After(now):
+			// Nothing can sign right now, so the new key starts immediately
+			notBefore = now
+		case !newest[0].NotBefore.Add(m.Options.RotationInterval - m.Options.PublishAhead).After(now):
+			notBefore = newest[0].NotBefore.Add(m.Options.RotationInterval)
+		default:
+			return nil
+		}
+		return m.create(tx, notBefore)
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.load(ctx, now)
+}
+
+// Rotate publishes a new key that takes over signing after PublishAhead,
+// e.g. when the current key may have been exposed.
+func (m *KeyManager) Rotate(ctx context.Context) error {
+	if err := m.create(m.DB.WithContext(ctx), time.Now().Add(m.Options.PublishAhead)); err != nil {
+		return err
+	}
+	return m.load(ctx, time.Now())
+}
+
+func (m *KeyManager) create(db *gorm.DB, notBefore time.Time) error {
+	row, err := generateKey(m.Options.Algorithm)
+	if err != nil {
+		return err
+	}
+	row.NotBefore = notBefore
+	row.ExpiresAt = notBefore.Add(m.Options.RotationInterval + m.Options.VerifyGrace)
+
+	if err := db.Create(row).Error; err != nil {
+		return err
+	}
+
+	log.Printf("Created signing key %s, signing from %s", row.Kid, notBefore.Format(time.RFC3339))
+	return nil
+}
+
+func (m *KeyManager) load(ctx context.Context, now time.Time) error {
+	var rows []models.SigningKey
+	if err := m.DB.WithContext(ctx).Where("expires_at > ?", now).Order("not_before").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	keys := make([]*signingKey, 0, len(rows))
+	for _, row := range rows {
+		key, err := parseKey(row)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", row.Kid, err)
+		}
+		keys = append(keys, key)
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.mu.Unlock()
+	return nil
+}
+
+// Sign signs claims with the current key and sets the kid header.
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	key := m.current(time.Now())
+	if key == nil {
+		return "", errors.New("no signing key available")
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// Keyfunc returns the public key for the token's kid, for use with
+// jwt.Parse. Tokens whose algorithm does not match the key are rejected.
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.keys {
+		if key.kid != kid {
+			continue
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.private.Public(), nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// JWKS returns the public half of every published key.
+func (m *KeyManager) JWKS() (*jwk.Set, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := &jwk.Set{Keys: make([]jwk.Key, 0, len(m.keys))}
+	for _, key := range m.keys {
+		k, err := jwk.FromPublicKey(key.private.Public())
+		if err != nil {
+			return nil, err
+		}
+		k.Kid = key.kid
+		k.Use = "sig"
+		k.Alg = key.method.Alg()
+		set.Keys = append(set.Keys, k)
+	}
+	return set, nil
+}
+
+// current returns the newest key of the configured algorithm that has
+// started signing. Keys of other algorithms are only used for verification,
+// e.g. after switching from RS256 to EdDSA.
+func (m *KeyManager) current(now time.Time) *signingKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		key := m.keys[i]
+		if key.method.Alg() == m.Options.Algorithm && !key.notBefore.After(now) && key.expiresAt.After(now) {
+			return key
+		}
+	}
+	return nil
+}
+
+func generateKey(algorithm string) (*models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	kid := make([]byte, 16)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		Kid:        fmt.Sprintf("%x", kid),
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}, nil
+}
+
+func parseKey(row models.SigningKey) (*signingKey, error) {
+	method, err := signingMethod(row.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(row.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+
+	return &signingKey{
+		kid:       row.Kid,
+		method:    method,
+		private:   private,
+		notBefore: row.NotBefore,
+		expiresAt: row.ExpiresAt,
+	}, nil
+}
+
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+}
+
+// MaxTokenTTL is the longest any token may live. Keys stay published for
+// this long after they stop signing, so every token they signed can still
+// be verified.
+const MaxTokenTTL = 24 * time.Hour
+
+// DefaultOptions returns options for algorithm rotating keys every rotation.
+// Keys are published well before they sign and for MaxTokenTTL after.
+func DefaultOptions(algorithm string, rotation time.Duration) Options {
+	publishAhead := rotation / 4
+	if publishAhead > time.Hour {
+		publishAhead = time.Hour
+	}
+
+	return Options{
+		Algorithm:        algorithm,
+		RotationInterval: rotation,
+		PublishAhead:     publishAhead,
+		VerifyGrace:      MaxTokenTTL,
+	}
+}
@@ -1,62 +1,148 @@
 package utils
 
 import (
+	"crypto/subtle"
 	"errors"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/signing"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 	"gorm.io/gorm"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET"))
+// lastSeenResolution limits how often a session's LastSeenAt is written.
+const lastSeenResolution = time.Minute
 
 type Claims struct {
-	UserID int `json:"user_id"`
+	UserID       int    `json:"user_id"`
+	SessionID    uint   `json:"sid"`
+	TokenVersion int    `json:"ver"`
+	Purpose      string `json:"purpose,omitempty"`
+	Scope        string `json:"scope,omitempty"` // Space separated, see package scope
 	jwt.RegisteredClaims
 }
 
-func ExtractUserIDFromToken(c *fiber.Ctx, db *gorm.DB) (int, error) {
+// APIKeyHeader carries an API key in place of a Bearer token.
+const APIKeyHeader = "X-API-Key"
+
+// ExtractUserIDFromToken returns the caller's user ID from either an API key
+// or a Bearer token. API keys act on behalf of the user who created them.
+func ExtractUserIDFromToken(c *fiber.Ctx, db *gorm.DB, keys *signing.KeyManager) (int, error) {
+	if c.Get(APIKeyHeader) != "" {
+		user, _, err := AuthenticateAPIKey(c, db)
+		if err != nil {
+			return 0, err
+		}
+		return int(user.ID), nil
+	}
+
+	user, _, err := AuthenticateRequest(c, db, keys)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(user.ID), nil
+}
+
+// AuthenticateAPIKey validates the X-API-Key header and returns the user the
+// key acts for along with the key. The user must still belong to the key's
+// organisation.
+func AuthenticateAPIKey(c *fiber.Ctx, db *gorm.DB) (*models.User, *models.APIKey, error) {
+	raw := c.Get(APIKeyHeader)
+	prefix, err := ParseAPIKey(raw)
+	if err != nil {
+		return nil, nil, errors.New("invalid API key")
+	}
+
+	var key models.APIKey
+	if err := db.Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		return nil, nil, errors.New("invalid API key")
+	}
+	if subtle.ConstantTimeCompare([]byte(HashToken(raw)), []byte(key.KeyHash)) != 1 {
+		return nil, nil, errors.New("invalid API key")
+	}
+
+	now := time.Now()
+	if !key.IsActive(now) {
+		return nil, nil, errors.New("API key expired or revoked")
+	}
+
+	var user models.User
+	if err := db.First(&user, key.CreatedByID).Error; err != nil {
+		return nil, nil, errors.New("invalid API key")
+	}
+	if user.OrganisationID == nil || *user.OrganisationID != key.OrganisationID {
+		return nil, nil, errors.New("API key owner is no longer a member of the organisation")
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastSeenResolution {
+		db.Model(&key).Update("last_used_at", now)
+	}
+
+	return &user, &key, nil
+}
+
+// AuthenticateRequest validates the Bearer token on the request and returns
+// the user it belongs to along with the token's claims. The signature is
+// checked against the published key named by the token's kid.
+func AuthenticateRequest(c *fiber.Ctx, db *gorm.DB, keys *signing.KeyManager) (*models.User, *Claims, error) {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
-		return 0, errors.New("missing Authorization header")
+		return nil, nil, errors.New("missing Authorization header")
 	}
 
 	parts := strings.Split(authHeader, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		return 0, errors.New("invalid Authorization header format")
+		return nil, nil, errors.New("invalid Authorization header format")
 	}
 
 	tokenString := parts[1]
 
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc)
 
 	if err != nil {
 		if err == jwt.ErrSignatureInvalid {
-			return 0, errors.New("invalid token signature")
+			return nil, nil, errors.New("invalid token signature")
 		}
-		return 0, errors.New("invalid token")
+		return nil, nil, errors.New("invalid token")
 	}
 
 	if !token.Valid {
-		return 0, errors.New("invalid token")
+		return nil, nil, errors.New("invalid token")
 	}
 
 	if time.Now().Unix() > claims.ExpiresAt.Unix() {
-		return 0, errors.New("token expired")
+		return nil, nil, errors.New("token expired")
 	}
 
-	var user models.User
-	result := db.Where("id = ? AND token = ?", claims.UserID, tokenString).First(&user)
+	// Purpose-bound tokens such as MFA challenges are not access tokens
+	if claims.Purpose != "" {
+		return nil, nil, errors.New("invalid token")
+	}
+
+	var session models.AuthSession
+	result := db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", claims.SessionID, claims.UserID).First(&session)
 	if result.Error != nil {
-		return 0, errors.New("token not found or invalid")
+		return nil, nil, errors.New("session not found or revoked")
+	}
+
+	var user models.User
+	if err := db.First(&user, claims.UserID).Error; err != nil {
+		return nil, nil, errors.New("user not found")
+	}
+
+	// Logging out everywhere bumps the user's token version
+	if claims.TokenVersion != user.TokenVersion {
+		return nil, nil, errors.New("token has been revoked")
+	}
+
+	if now := time.Now(); now.Sub(session.LastSeenAt) > lastSeenResolution {
+		db.Model(&session).Update("last_seen_at", now)
 	}
 
-	return claims.UserID, nil
+	return &user, claims, nil
 }
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/scope"
+	"github.com/OPTIC7409/tutor-api/internal/signing"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	MFATokenTTL     = 5 * time.Minute
+
+	mfaPurpose = "mfa"
+)
+
+// GenerateAccessToken signs a short-lived access token for user bound to
+// the given AuthSession, carrying every scope of the user's role.
+func GenerateAccessToken(keys *signing.KeyManager, user *models.User, sessionID uint) (string, error) {
+	return GenerateScopedToken(keys, user, sessionID, scope.ForRole(user.UserType), AccessTokenTTL)
+}
+
+// GenerateScopedToken signs an access token limited to scopes. It is bound
+// to the session like any access token, so it dies with the session. ttl
+// may not exceed signing.MaxTokenTTL.
+func GenerateScopedToken(keys *signing.KeyManager, user *models.User, sessionID uint, scopes []string, ttl time.Duration) (string, error) {
+	if ttl > signing.MaxTokenTTL {
+		return "", errors.New("token lifetime exceeds the signing key grace period")
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		UserID:       int(user.ID),
+		SessionID:    sessionID,
+		TokenVersion: user.TokenVersion,
+		Scope:        scope.Format(scopes),
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	return keys.Sign(claims)
+}
+
+// GenerateMFAToken signs the short-lived token returned by login when the
+// user still has to complete a second factor.
+func GenerateMFAToken(keys *signing.KeyManager, user *models.User) (string, error) {
+	now := time.Now()
+	claims := &Claims{
+		UserID:       int(user.ID),
+		TokenVersion: user.TokenVersion,
+		Purpose:      mfaPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(MFATokenTTL)),
+		},
+	}
+
+	return keys.Sign(claims)
+}
+
+// ParseMFAToken validates a token from GenerateMFAToken.
+func ParseMFAToken(keys *signing.KeyManager, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc)
+	if err != nil || !token.Valid || claims.Purpose != mfaPurpose {
+		return nil, errors.New("invalid or expired MFA token")
+	}
+
+	return claims, nil
+}
+
+// GenerateRandomToken returns n random bytes encoded as URL-safe base64.
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex SHA-256 digest stored in place of opaque tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewRefreshToken creates the opaque "<family>.<secret>" refresh token for a
+// token family. Only the hash of the full token is persisted.
+func NewRefreshToken(familyID string) (token string, hash string, err error) {
+	secret, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	token = familyID + "." + secret
+	return token, HashToken(token), nil
+}
+
+// ParseRefreshToken extracts the family ID from a refresh token.
+func ParseRefreshToken(token string) (string, error) {
+	familyID, secret, found := strings.Cut(token, ".")
+	if !found || familyID == "" || secret == "" {
+		return "", errors.New("malformed refresh token")
+	}
+	return familyID, nil
+}
+
+// APIKeyPrefix marks API keys so they are easy to recognise, e.g. by secret
+// scanners.
+const APIKeyPrefix = "tk_"
+
+// NewAPIKey creates an API key of the form "tk_<prefix>_<secret>". The
+// prefix is stored in clear to find the key; only the hash of the full key
+// is persisted.
+func NewAPIKey() (key string, prefix string, hash string, err error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(b)
+
+	secret, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	key = APIKeyPrefix + prefix + "_" + secret
+	return key, prefix, HashToken(key), nil
+}
+
+// ParseAPIKey extracts the prefix from an API key.
+func ParseAPIKey(key string) (string, error) {
+	prefix, secret, found := strings.Cut(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	if !strings.HasPrefix(key, APIKeyPrefix) || !found || prefix == "" || secret == "" {
+		return "", errors.New("malformed API key")
+	}
+	return prefix, nil
+}
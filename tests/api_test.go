@@ -8,10 +8,17 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/OPTIC7409/tutor-api/config"
 	"github.com/OPTIC7409/tutor-api/internal/database"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/totp"
 	"gorm.io/gorm"
 )
 
@@ -26,6 +33,7 @@ type TestCase struct {
 	Method   string
 	URL      string
 	Body     interface{}
+	Auth     bool
 	Expected int
 }
 
@@ -90,8 +98,83 @@ func findRootDir() (string, error) {
 	}
 }
 
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+func postJSON(t *testing.T, url string, body interface{}, result interface{}) int {
+	jsonBody, _ := json.Marshal(body)
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if result != nil {
+		json.NewDecoder(resp.Body).Decode(result)
+	}
+
+	return resp.StatusCode
+}
+
+func authRequest(t *testing.T, method, url, token string, body interface{}, result interface{}) int {
+	return sendRequest(t, method, url, "Authorization", "Bearer "+token, body, result)
+}
+
+func apiKeyRequest(t *testing.T, method, url, key string, body interface{}, result interface{}) int {
+	return sendRequest(t, method, url, "X-API-Key", key, body, result)
+}
+
+func sendRequest(t *testing.T, method, url, header, value string, body interface{}, result interface{}) int {
+	var payload *bytes.Buffer
+	if body != nil {
+		jsonBody, _ := json.Marshal(body)
+		payload = bytes.NewBuffer(jsonBody)
+	} else {
+		payload = &bytes.Buffer{}
+	}
+
+	req, err := http.NewRequest(method, url, payload)
+	if err != nil {
+		t.Fatalf("Error building request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(header, value)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if result != nil {
+		json.NewDecoder(resp.Body).Decode(result)
+	}
+
+	return resp.StatusCode
+}
+
+func loginTokens(t *testing.T, baseURL, email, password string) tokenPair {
+	var tokens tokenPair
+	status := postJSON(t, baseURL+"/auth/login", map[string]interface{}{
+		"email":    email,
+		"password": password,
+	}, &tokens)
+	if status != http.StatusOK || tokens.Token == "" {
+		t.Fatalf("Failed to log in as %s (status %d)", email, status)
+	}
+
+	return tokens
+}
+
+func login(t *testing.T, baseURL, email, password string) string {
+	return loginTokens(t, baseURL, email, password).Token
+}
+
 func TestAPI(t *testing.T) {
 	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	token := login(t, baseURL, "john@example.com", "password123")
 
 	testCases := []TestCase{
 		{
@@ -118,6 +201,30 @@ func TestAPI(t *testing.T) {
 			},
 			Expected: http.StatusConflict,
 		},
+		{
+			Name:   "Register Admin User",
+			Method: "POST",
+			URL:    baseURL + "/auth/register",
+			Body: map[string]interface{}{
+				"name":     "Sneaky User",
+				"email":    "sneaky@example.com",
+				"password": "password123",
+				"userType": "admin",
+			},
+			Expected: http.StatusForbidden,
+		},
+		{
+			Name:   "Register Unknown User Type",
+			Method: "POST",
+			URL:    baseURL + "/auth/register",
+			Body: map[string]interface{}{
+				"name":     "Odd User",
+				"email":    "odd@example.com",
+				"password": "password123",
+				"userType": "wizard",
+			},
+			Expected: http.StatusBadRequest,
+		},
 		{
 			Name:   "Login User",
 			Method: "POST",
@@ -128,22 +235,55 @@ func TestAPI(t *testing.T) {
 			},
 			Expected: http.StatusOK,
 		},
+		{
+			Name:   "Login Registered User",
+			Method: "POST",
+			URL:    baseURL + "/auth/login",
+			Body: map[string]interface{}{
+				"email":    "johna@example.com",
+				"password": "password123",
+			},
+			Expected: http.StatusOK,
+		},
+		{
+			Name:     "Get Tutors Without Token",
+			Method:   "GET",
+			URL:      baseURL + "/tutors",
+			Expected: http.StatusUnauthorized,
+		},
 		{
 			Name:     "Get Tutors",
 			Method:   "GET",
 			URL:      baseURL + "/tutors",
+			Auth:     true,
 			Expected: http.StatusOK,
 		},
+		{
+			Name:     "Get Students As Student",
+			Method:   "GET",
+			URL:      baseURL + "/students",
+			Auth:     true,
+			Expected: http.StatusForbidden,
+		},
+		{
+			Name:     "Delete Another User's Tutor Profile",
+			Method:   "DELETE",
+			URL:      baseURL + "/tutors/1",
+			Auth:     true,
+			Expected: http.StatusForbidden,
+		},
 		{
 			Name:     "Get Chats",
 			Method:   "GET",
 			URL:      baseURL + "/chats",
+			Auth:     true,
 			Expected: http.StatusOK,
 		},
 		{
 			Name:     "Get Chat",
 			Method:   "GET",
 			URL:      baseURL + "/chats/1",
+			Auth:     true,
 			Expected: http.StatusOK,
 		},
 		{
@@ -154,25 +294,45 @@ func TestAPI(t *testing.T) {
 				"senderID": 1,
 				"content":  "Hello, this is a test message.",
 			},
+			Auth:     true,
 			Expected: http.StatusCreated,
 		},
+		{
+			Name:     "Get Dashboard",
+			Method:   "GET",
+			URL:      baseURL + "/user/dashboard",
+			Auth:     true,
+			Expected: http.StatusOK,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
-			var resp *http.Response
+			var req *http.Request
 			var err error
 
 			switch tc.Method {
-			case "GET":
-				resp, err = http.Get(tc.URL)
-			case "POST":
+			case "GET", "DELETE":
+				req, err = http.NewRequest(tc.Method, tc.URL, nil)
+			case "POST", "PUT":
 				jsonBody, _ := json.Marshal(tc.Body)
-				resp, err = http.Post(tc.URL, "application/json", bytes.NewBuffer(jsonBody))
+				req, err = http.NewRequest(tc.Method, tc.URL, bytes.NewBuffer(jsonBody))
+				if err == nil {
+					req.Header.Set("Content-Type", "application/json")
+				}
 			default:
 				t.Fatalf("Unsupported HTTP method: %s", tc.Method)
 			}
 
+			if err != nil {
+				t.Fatalf("Error building request: %v", err)
+			}
+
+			if tc.Auth {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
 			if err != nil {
 				t.Fatalf("Error making request: %v", err)
 			}
@@ -193,3 +353,1767 @@ func TestAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestRefreshTokenRotation(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	initial := loginTokens(t, baseURL, "jane@example.com", "password456")
+
+	var rotated tokenPair
+	status := postJSON(t, baseURL+"/auth/refresh", map[string]interface{}{"refreshToken": initial.RefreshToken}, &rotated)
+	if status != http.StatusOK || rotated.RefreshToken == "" || rotated.RefreshToken == initial.RefreshToken {
+		t.Fatalf("Expected a rotated refresh token, got status %d", status)
+	}
+
+	status = postJSON(t, baseURL+"/auth/refresh", map[string]interface{}{"refreshToken": initial.RefreshToken}, nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("Expected replayed refresh token to be rejected, got status %d", status)
+	}
+
+	status = postJSON(t, baseURL+"/auth/refresh", map[string]interface{}{"refreshToken": rotated.RefreshToken}, nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("Expected token family to be revoked after reuse, got status %d", status)
+	}
+}
+
+func TestMultiDeviceSessions(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	laptop := login(t, baseURL, "jane@example.com", "password456")
+	phone := login(t, baseURL, "jane@example.com", "password456")
+
+	var sessions []struct {
+		ID      uint `json:"id"`
+		Current bool `json:"current"`
+	}
+	if status := authRequest(t, "GET", baseURL+"/auth/sessions", laptop, nil, &sessions); status != http.StatusOK {
+		t.Fatalf("Expected status 200 listing sessions, got %d", status)
+	}
+	if len(sessions) < 2 {
+		t.Fatalf("Expected at least two sessions, got %d", len(sessions))
+	}
+
+	var phoneSessions []struct {
+		ID      uint `json:"id"`
+		Current bool `json:"current"`
+	}
+	authRequest(t, "GET", baseURL+"/auth/sessions", phone, nil, &phoneSessions)
+	var phoneSessionID uint
+	for _, session := range phoneSessions {
+		if session.Current {
+			phoneSessionID = session.ID
+		}
+	}
+
+	url := fmt.Sprintf("%s/auth/sessions/%d", baseURL, phoneSessionID)
+	if status := authRequest(t, "DELETE", url, laptop, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("Expected status 204 revoking session, got %d", status)
+	}
+
+	if status := authRequest(t, "GET", baseURL+"/user/dashboard", phone, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected revoked session to be rejected, got %d", status)
+	}
+	if status := authRequest(t, "GET", baseURL+"/auth/sessions", laptop, nil, nil); status != http.StatusOK {
+		t.Errorf("Expected other session to stay logged in, got %d", status)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	laptop := loginTokens(t, baseURL, "jane@example.com", "password456")
+	phone := loginTokens(t, baseURL, "jane@example.com", "password456")
+	tablet := loginTokens(t, baseURL, "jane@example.com", "password456")
+
+	if status := authRequest(t, "POST", baseURL+"/auth/logout", laptop.Token, nil, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 logging out, got %d", status)
+	}
+	if status := authRequest(t, "GET", baseURL+"/user/dashboard", laptop.Token, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected logged out token to be rejected, got %d", status)
+	}
+	if status := authRequest(t, "GET", baseURL+"/auth/sessions", phone.Token, nil, nil); status != http.StatusOK {
+		t.Errorf("Expected other devices to stay logged in, got %d", status)
+	}
+
+	if status := authRequest(t, "POST", baseURL+"/auth/logout-all", phone.Token, nil, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 logging out everywhere, got %d", status)
+	}
+	if status := authRequest(t, "GET", baseURL+"/auth/sessions", tablet.Token, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected every access token to be rejected, got %d", status)
+	}
+	if status := postJSON(t, baseURL+"/auth/refresh", map[string]interface{}{"refreshToken": tablet.RefreshToken}, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected every refresh token to be rejected, got %d", status)
+	}
+}
+
+// lastMailTo returns the body of the newest email the server's file mailer
+// wrote for the given address.
+func lastMailTo(t *testing.T, to string) string {
+	dir := os.Getenv("MAIL_DIR")
+	if dir == "" {
+		t.Skip("MAIL_DIR is not set; cannot read emails sent by the server")
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*-"+to+".txt"))
+	if err != nil || len(matches) == 0 {
+		t.Fatalf("No email found for %s in %s", to, dir)
+	}
+	sort.Strings(matches)
+
+	content, err := os.ReadFile(matches[len(matches)-1])
+	if err != nil {
+		t.Fatalf("Error reading email: %v", err)
+	}
+	return string(content)
+}
+
+var tokenParam = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func TestPasswordReset(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	email := "reset@example.com"
+	postJSON(t, baseURL+"/auth/register", map[string]interface{}{
+		"name":     "Reset User",
+		"email":    email,
+		"password": "oldpassword",
+		"userType": "student",
+	}, nil)
+	session := login(t, baseURL, email, "oldpassword")
+
+	if status := postJSON(t, baseURL+"/auth/forgot-password", map[string]interface{}{"email": email}, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 requesting reset, got %d", status)
+	}
+	if status := postJSON(t, baseURL+"/auth/forgot-password", map[string]interface{}{"email": "nobody@example.com"}, nil); status != http.StatusOK {
+		t.Errorf("Expected unknown emails to get the same response, got %d", status)
+	}
+
+	match := tokenParam.FindStringSubmatch(lastMailTo(t, email))
+	if match == nil {
+		t.Fatalf("Reset email does not contain a token")
+	}
+	body := map[string]interface{}{"token": match[1], "password": "newpassword"}
+	if status := postJSON(t, baseURL+"/auth/reset-password", body, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 resetting password, got %d", status)
+	}
+	if status := postJSON(t, baseURL+"/auth/reset-password", body, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected reset token to be single-use, got %d", status)
+	}
+
+	if status := authRequest(t, "GET", baseURL+"/auth/sessions", session, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected existing sessions to be revoked, got %d", status)
+	}
+	if status := postJSON(t, baseURL+"/auth/login", map[string]interface{}{"email": email, "password": "oldpassword"}, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected old password to stop working, got %d", status)
+	}
+	login(t, baseURL, email, "newpassword")
+}
+
+func TestEmailVerification(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	email := "verify@example.com"
+	postJSON(t, baseURL+"/auth/register", map[string]interface{}{
+		"name":     "Verify User",
+		"email":    email,
+		"password": "password123",
+		"userType": "tutor",
+	}, nil)
+	token := login(t, baseURL, email, "password123")
+
+	profile := map[string]interface{}{"subject": "Chemistry", "yearsExperience": 2, "hourlyRate": 30, "location": "Leeds"}
+	if status := authRequest(t, "POST", baseURL+"/tutors", token, profile, nil); status != http.StatusForbidden {
+		t.Fatalf("Expected unverified user to be blocked, got %d", status)
+	}
+
+	if status := authRequest(t, "POST", baseURL+"/auth/resend-verification", token, nil, nil); status != http.StatusTooManyRequests {
+		t.Errorf("Expected resend right after registering to be rate limited, got %d", status)
+	}
+
+	match := tokenParam.FindStringSubmatch(lastMailTo(t, email))
+	if match == nil {
+		t.Fatalf("Verification email does not contain a token")
+	}
+
+	if status := postJSON(t, baseURL+"/auth/verify-email", map[string]interface{}{"token": match[1]}, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 verifying email, got %d", status)
+	}
+
+	if status := authRequest(t, "POST", baseURL+"/tutors", token, profile, nil); status != http.StatusCreated {
+		t.Errorf("Expected verified user to create a tutor profile, got %d", status)
+	}
+}
+
+func TestProfileFields(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	verifiedAt := time.Now()
+	user := models.User{Name: "Fields Tutor", Email: "fields@example.com", Password: "password123", UserType: "tutor", EmailVerifiedAt: &verifiedAt}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Error creating tutor user: %v", err)
+	}
+	token := login(t, baseURL, user.Email, "password123")
+
+	var jane models.Tutor
+	if err := db.Joins("User").Where(`"User".email = ?`, "jane@example.com").First(&jane).Error; err != nil {
+		t.Fatalf("Error loading Jane's profile: %v", err)
+	}
+
+	// Only profile fields are taken from the body; IDs, ratings and the user
+	// account are not
+	var created models.Tutor
+	body := map[string]interface{}{
+		"subject": "Physics", "yearsExperience": 2, "hourlyRate": 30, "location": "Leeds",
+		"ID": jane.ID, "UserID": jane.UserID, "RatingAverage": 5, "RatingCount": 100,
+		"User": map[string]interface{}{"name": "Intruder", "email": "intruder@example.com", "password": "password123", "userType": "admin"},
+	}
+	if status := authRequest(t, "POST", baseURL+"/tutors", token, body, &created); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating a tutor, got %d", status)
+	}
+	if created.ID == jane.ID || created.UserID != user.ID || created.RatingCount != 0 {
+		t.Errorf("Expected a new unrated profile for the caller, got %+v", created)
+	}
+	var intruders int64
+	db.Model(&models.User{}).Where("email = ?", "intruder@example.com").Count(&intruders)
+	if intruders != 0 {
+		t.Errorf("Expected no account to be created from the profile body")
+	}
+
+	var updated models.Tutor
+	body = map[string]interface{}{"subject": "Astrophysics", "ID": jane.ID, "UserID": jane.UserID}
+	if status := authRequest(t, "PUT", fmt.Sprintf("%s/tutors/%d", baseURL, created.ID), token, body, &updated); status != http.StatusOK {
+		t.Fatalf("Expected status 200 updating a tutor, got %d", status)
+	}
+	if updated.ID != created.ID || updated.UserID != user.ID || updated.Subject != "Astrophysics" || updated.Location != "Leeds" {
+		t.Errorf("Expected only the subject to change, got %+v", updated)
+	}
+	var reloaded models.Tutor
+	db.First(&reloaded, jane.ID)
+	if reloaded.Subject != jane.Subject || reloaded.UserID != jane.UserID {
+		t.Errorf("Expected Jane's profile to be untouched, got %+v", reloaded)
+	}
+
+	// Tutors only see the profiles of students they deal with
+	pupil := models.User{Name: "Fields Student", Email: "fields-student@example.com", Password: "password123", UserType: "student", EmailVerifiedAt: &verifiedAt}
+	if err := db.Create(&pupil).Error; err != nil {
+		t.Fatalf("Error creating student user: %v", err)
+	}
+	profile := models.Student{UserID: pupil.ID, Age: 15}
+	if err := db.Create(&profile).Error; err != nil {
+		t.Fatalf("Error creating student profile: %v", err)
+	}
+	studentURL := fmt.Sprintf("%s/students/%d", baseURL, profile.ID)
+	for _, url := range []string{studentURL, studentURL + "/subjects"} {
+		if status := authRequest(t, "GET", url, token, nil, nil); status != http.StatusForbidden {
+			t.Errorf("Expected a stranger tutor to be refused %s, got %d", url, status)
+		}
+	}
+	if err := db.Create(&models.Chat{Participants: []models.User{user, pupil}}).Error; err != nil {
+		t.Fatalf("Error creating chat: %v", err)
+	}
+	for _, url := range []string{studentURL, studentURL + "/subjects"} {
+		if status := authRequest(t, "GET", url, token, nil, nil); status != http.StatusOK {
+			t.Errorf("Expected a tutor chatting with the student to read %s, got %d", url, status)
+		}
+	}
+}
+
+func TestChangeCredentials(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	email := "credentials@example.com"
+	postJSON(t, baseURL+"/auth/register", map[string]interface{}{
+		"name":     "Credentials User",
+		"email":    email,
+		"password": "password123",
+		"userType": "student",
+	}, nil)
+	current := login(t, baseURL, email, "password123")
+	other := login(t, baseURL, email, "password123")
+
+	wrong := map[string]interface{}{"currentPassword": "wrongpassword", "newPassword": "newpassword123"}
+	if status := authRequest(t, "PUT", baseURL+"/user/password", current, wrong, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected wrong current password to be rejected, got %d", status)
+	}
+
+	change := map[string]interface{}{"currentPassword": "password123", "newPassword": "newpassword123"}
+	if status := authRequest(t, "PUT", baseURL+"/user/password", current, change, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 changing password, got %d", status)
+	}
+	if status := authRequest(t, "GET", baseURL+"/auth/sessions", other, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected other sessions to be revoked, got %d", status)
+	}
+	if status := authRequest(t, "GET", baseURL+"/auth/sessions", current, nil, nil); status != http.StatusOK {
+		t.Errorf("Expected current session to stay logged in, got %d", status)
+	}
+
+	// Logging in twice more proves the new password was hashed exactly once
+	login(t, baseURL, email, "newpassword123")
+	login(t, baseURL, email, "newpassword123")
+
+	newEmail := "changed@example.com"
+	body := map[string]interface{}{"email": newEmail, "password": "newpassword123"}
+	if status := authRequest(t, "PUT", baseURL+"/user/email", current, body, nil); status != http.StatusAccepted {
+		t.Fatalf("Expected status 202 changing email, got %d", status)
+	}
+	login(t, baseURL, email, "newpassword123")
+
+	match := tokenParam.FindStringSubmatch(lastMailTo(t, newEmail))
+	if match == nil {
+		t.Fatalf("Verification email does not contain a token")
+	}
+	if status := postJSON(t, baseURL+"/auth/verify-email", map[string]interface{}{"token": match[1]}, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 verifying new email, got %d", status)
+	}
+	current = login(t, baseURL, newEmail, "newpassword123")
+
+	// A password that looks like a bcrypt hash is still hashed, so the hash
+	// itself is the password rather than whatever it was computed from
+	lookalike, err := models.HashPassword("hiddenpassword")
+	if err != nil {
+		t.Fatalf("Error hashing password: %v", err)
+	}
+	change = map[string]interface{}{"currentPassword": "newpassword123", "newPassword": lookalike}
+	if status := authRequest(t, "PUT", baseURL+"/user/password", current, change, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 changing password, got %d", status)
+	}
+	if status := postJSON(t, baseURL+"/auth/login", map[string]interface{}{"email": newEmail, "password": "hiddenpassword"}, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected the value behind a submitted hash to be refused, got %d", status)
+	}
+	login(t, baseURL, newEmail, lookalike)
+}
+
+func TestVerifyContestedEmail(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	contested := "contested@example.com"
+
+	// Two accounts ask to move to the same address; only the first to verify gets it
+	var tokens []string
+	for i := 0; i < 2; i++ {
+		verifiedAt := time.Now()
+		user := models.User{Name: "Contender", Email: fmt.Sprintf("contender-%d@example.com", i), Password: "password123", UserType: "student", EmailVerifiedAt: &verifiedAt}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("Error creating contender: %v", err)
+		}
+		token := login(t, baseURL, user.Email, "password123")
+		body := map[string]interface{}{"email": contested, "password": "password123"}
+		if status := authRequest(t, "PUT", baseURL+"/user/email", token, body, nil); status != http.StatusAccepted {
+			t.Fatalf("Expected status 202 changing email, got %d", status)
+		}
+		match := tokenParam.FindStringSubmatch(lastMailTo(t, contested))
+		if match == nil {
+			t.Fatalf("Verification email does not contain a token")
+		}
+		tokens = append(tokens, match[1])
+	}
+
+	if status := postJSON(t, baseURL+"/auth/verify-email", map[string]interface{}{"token": tokens[0]}, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 verifying the first change, got %d", status)
+	}
+	if status := postJSON(t, baseURL+"/auth/verify-email", map[string]interface{}{"token": tokens[1]}, nil); status != http.StatusConflict {
+		t.Errorf("Expected verifying a taken email to conflict, got %d", status)
+	}
+	login(t, baseURL, "contender-1@example.com", "password123")
+}
+
+func TestTwoFactorAuthentication(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	email := "mfa@example.com"
+	postJSON(t, baseURL+"/auth/register", map[string]interface{}{
+		"name":     "MFA Tutor",
+		"email":    email,
+		"password": "password123",
+		"userType": "tutor",
+	}, nil)
+	token := login(t, baseURL, email, "password123")
+
+	var enrollment struct {
+		Secret        string   `json:"secret"`
+		OTPAuthURI    string   `json:"otpauthUri"`
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	if status := authRequest(t, "POST", baseURL+"/auth/2fa/enroll", token, nil, &enrollment); status != http.StatusOK {
+		t.Fatalf("Expected status 200 enrolling, got %d", status)
+	}
+	if len(enrollment.RecoveryCodes) == 0 || enrollment.OTPAuthURI == "" {
+		t.Fatalf("Expected an otpauth URI and recovery codes, got %+v", enrollment)
+	}
+
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(enrollment.Secret, step)
+	if status := authRequest(t, "POST", baseURL+"/auth/2fa/confirm", token, map[string]interface{}{"code": code}, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 confirming, got %d", status)
+	}
+
+	var challenge struct {
+		MFARequired bool   `json:"mfaRequired"`
+		MFAToken    string `json:"mfaToken"`
+	}
+	postJSON(t, baseURL+"/auth/login", map[string]interface{}{"email": email, "password": "password123"}, &challenge)
+	if !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Fatalf("Expected login to require a second factor")
+	}
+	if status := authRequest(t, "GET", baseURL+"/auth/sessions", challenge.MFAToken, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected MFA token to be rejected as an access token, got %d", status)
+	}
+
+	// The confirmation code has been used already
+	if status := postJSON(t, baseURL+"/auth/login/mfa", map[string]interface{}{"mfaToken": challenge.MFAToken, "code": code}, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected a replayed code to be rejected, got %d", status)
+	}
+
+	recovery := map[string]interface{}{"mfaToken": challenge.MFAToken, "recoveryCode": enrollment.RecoveryCodes[0]}
+	var tokens tokenPair
+	if status := postJSON(t, baseURL+"/auth/login/mfa", recovery, &tokens); status != http.StatusOK || tokens.Token == "" {
+		t.Fatalf("Expected recovery code to complete login, got %d", status)
+	}
+	if status := postJSON(t, baseURL+"/auth/login/mfa", recovery, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected recovery code to be single-use, got %d", status)
+	}
+
+	next, _ := totp.Code(enrollment.Secret, step+1)
+	if status := authRequest(t, "POST", baseURL+"/auth/2fa/disable", tokens.Token, map[string]interface{}{"code": next}, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 disabling, got %d", status)
+	}
+	login(t, baseURL, email, "password123")
+}
+
+func TestDisableTwoFactorThrottling(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	email := "mfa-guess@example.com"
+	postJSON(t, baseURL+"/auth/register", map[string]interface{}{
+		"name":     "MFA Guess",
+		"email":    email,
+		"password": "password123",
+		"userType": "tutor",
+	}, nil)
+	token := login(t, baseURL, email, "password123")
+
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	authRequest(t, "POST", baseURL+"/auth/2fa/enroll", token, nil, &enrollment)
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(enrollment.Secret, step)
+	if status := authRequest(t, "POST", baseURL+"/auth/2fa/confirm", token, map[string]interface{}{"code": code}, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 confirming, got %d", status)
+	}
+
+	// Guessing codes backs off like guessing passwords
+	for i := 0; i < 4; i++ {
+		if status := authRequest(t, "POST", baseURL+"/auth/2fa/disable", token, map[string]interface{}{"code": "000000"}, nil); status != http.StatusUnauthorized {
+			t.Fatalf("Expected wrong code %d to be rejected with 401, got %d", i+1, status)
+		}
+	}
+	next, _ := totp.Code(enrollment.Secret, step+1)
+	if status := authRequest(t, "POST", baseURL+"/auth/2fa/disable", token, map[string]interface{}{"code": next}, nil); status != http.StatusTooManyRequests {
+		t.Errorf("Expected disabling during the backoff to be throttled, got %d", status)
+	}
+}
+
+func TestLoginThrottling(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	email := "throttle@example.com"
+	postJSON(t, baseURL+"/auth/register", map[string]interface{}{
+		"name":     "Throttle User",
+		"email":    email,
+		"password": "password123",
+		"userType": "student",
+	}, nil)
+
+	wrong := map[string]interface{}{"email": email, "password": "wrongpassword"}
+	for i := 0; i < 4; i++ {
+		if status := postJSON(t, baseURL+"/auth/login", wrong, nil); status != http.StatusUnauthorized {
+			t.Fatalf("Expected failed login %d to be rejected with 401, got %d", i+1, status)
+		}
+	}
+
+	// Even the right password has to wait for the backoff
+	right := map[string]interface{}{"email": email, "password": "password123"}
+	if status := postJSON(t, baseURL+"/auth/login", right, nil); status != http.StatusTooManyRequests {
+		t.Fatalf("Expected login during backoff to be throttled, got %d", status)
+	}
+
+	var user struct {
+		ID uint
+	}
+	if err := db.Table("users").Select("id").Where("email = ?", email).Scan(&user).Error; err != nil {
+		t.Fatalf("Error loading user: %v", err)
+	}
+
+	admin := login(t, baseURL, "admin@example.com", "password789")
+	if status := authRequest(t, "POST", fmt.Sprintf("%s/admin/users/%d/unlock", baseURL, user.ID), admin, nil, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 unlocking user, got %d", status)
+	}
+	login(t, baseURL, email, "password123")
+}
+
+func TestAPIKeys(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	admin := login(t, baseURL, "admin@example.com", "password789")
+	tutor := login(t, baseURL, "jane@example.com", "password456")
+	student := login(t, baseURL, "john@example.com", "password123")
+
+	var organisation struct {
+		ID uint `json:"id"`
+	}
+	if status := authRequest(t, "POST", baseURL+"/organisations", admin, map[string]interface{}{"name": "Springfield High"}, &organisation); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating organisation, got %d", status)
+	}
+	orgURL := fmt.Sprintf("%s/organisations/%d", baseURL, organisation.ID)
+
+	var jane struct {
+		ID uint
+	}
+	db.Table("users").Select("id").Where("email = ?", "jane@example.com").Scan(&jane)
+	if status := authRequest(t, "POST", orgURL+"/members", admin, map[string]interface{}{"userId": jane.ID}, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 adding member, got %d", status)
+	}
+
+	body := map[string]interface{}{"name": "Roster sync", "scopes": []string{"tutors:read"}}
+	if status := authRequest(t, "POST", orgURL+"/api-keys", student, body, nil); status != http.StatusForbidden {
+		t.Errorf("Expected non-member to be forbidden from creating keys, got %d", status)
+	}
+	if status := authRequest(t, "POST", orgURL+"/api-keys", tutor, body, nil); status != http.StatusForbidden {
+		t.Errorf("Expected a plain member to be forbidden from creating keys, got %d", status)
+	}
+	if status := authRequest(t, "GET", orgURL+"/api-keys", tutor, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Expected a plain member to be forbidden from listing keys, got %d", status)
+	}
+
+	// Signing up cannot join an organisation
+	email := "joiner@example.com"
+	postJSON(t, baseURL+"/auth/register", map[string]interface{}{
+		"name":           "Joiner",
+		"email":          email,
+		"password":       "password123",
+		"userType":       "tutor",
+		"organisationId": organisation.ID,
+		"totpEnabled":    true,
+	}, nil)
+	var joiner models.User
+	if err := db.Where("email = ?", email).First(&joiner).Error; err != nil {
+		t.Fatalf("Error loading registered user: %v", err)
+	}
+	if joiner.OrganisationID != nil || joiner.TOTPEnabled {
+		t.Errorf("Expected registration to ignore organisationId and totpEnabled, got %+v", joiner)
+	}
+
+	if status := authRequest(t, "POST", orgURL+"/members", admin, map[string]interface{}{"userId": jane.ID, "role": "owner"}, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected an unknown role to be rejected, got %d", status)
+	}
+	if status := authRequest(t, "POST", orgURL+"/members", admin, map[string]interface{}{"userId": jane.ID, "role": "admin"}, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 making member an admin, got %d", status)
+	}
+
+	// Members see each other's name and role but not their account details
+	var details struct {
+		Members []map[string]interface{} `json:"members"`
+	}
+	if status := authRequest(t, "GET", orgURL, tutor, nil, &details); status != http.StatusOK {
+		t.Fatalf("Expected status 200 reading organisation, got %d", status)
+	}
+	if len(details.Members) != 1 || details.Members[0]["role"] != "admin" || details.Members[0]["email"] != nil {
+		t.Errorf("Expected Jane listed as admin without her email, got %+v", details.Members)
+	}
+	if status := authRequest(t, "POST", orgURL+"/api-keys", tutor, map[string]interface{}{"name": "Sync", "scopes": []string{"admin"}}, nil); status != http.StatusForbidden {
+		t.Errorf("Expected non-admin to be forbidden from granting the admin scope, got %d", status)
+	}
+
+	var created struct {
+		Key    string `json:"key"`
+		APIKey struct {
+			ID     uint   `json:"id"`
+			Prefix string `json:"prefix"`
+		} `json:"apiKey"`
+	}
+	if status := authRequest(t, "POST", orgURL+"/api-keys", tutor, body, &created); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating API key, got %d", status)
+	}
+
+	if status := apiKeyRequest(t, "GET", baseURL+"/tutors", created.Key, nil, nil); status != http.StatusOK {
+		t.Errorf("Expected API key to read tutors, got %d", status)
+	}
+	if status := apiKeyRequest(t, "GET", baseURL+"/chats", created.Key, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Expected API key without chats scope to be forbidden, got %d", status)
+	}
+	if status := apiKeyRequest(t, "GET", orgURL+"/api-keys", created.Key, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Expected API key to be unable to manage keys, got %d", status)
+	}
+	if status := apiKeyRequest(t, "GET", baseURL+"/tutors", created.Key+"x", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected tampered API key to be rejected, got %d", status)
+	}
+
+	var keys []struct {
+		Prefix     string     `json:"prefix"`
+		LastUsedAt *time.Time `json:"lastUsedAt"`
+	}
+	authRequest(t, "GET", orgURL+"/api-keys", tutor, nil, &keys)
+	if len(keys) != 1 || keys[0].Prefix != created.APIKey.Prefix || keys[0].LastUsedAt == nil {
+		t.Errorf("Expected the key to be listed with its last use, got %+v", keys)
+	}
+
+	if status := authRequest(t, "DELETE", fmt.Sprintf("%s/api-keys/%d", orgURL, created.APIKey.ID), tutor, nil, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 revoking API key, got %d", status)
+	}
+	if status := apiKeyRequest(t, "GET", baseURL+"/tutors", created.Key, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected revoked API key to be rejected, got %d", status)
+	}
+}
+
+func TestScopedTokens(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	full := login(t, baseURL, "john@example.com", "password123")
+
+	var widget struct {
+		Token     string   `json:"token"`
+		Scopes    []string `json:"scopes"`
+		ExpiresIn int      `json:"expiresIn"`
+	}
+	body := map[string]interface{}{"scopes": []string{"dashboard:read"}, "expiresIn": 3600}
+	if status := authRequest(t, "POST", baseURL+"/auth/tokens", full, body, &widget); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating scoped token, got %d", status)
+	}
+	if widget.ExpiresIn != 3600 || len(widget.Scopes) != 1 {
+		t.Errorf("Unexpected scoped token response: %+v", widget)
+	}
+
+	if status := authRequest(t, "GET", baseURL+"/user/dashboard", widget.Token, nil, nil); status != http.StatusOK {
+		t.Errorf("Expected scoped token to read the dashboard, got %d", status)
+	}
+	if status := authRequest(t, "GET", baseURL+"/chats", widget.Token, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Expected scoped token to be forbidden from chats, got %d", status)
+	}
+	if status := authRequest(t, "GET", baseURL+"/subjects", widget.Token, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Expected scoped token to be forbidden from the subject catalogue, got %d", status)
+	}
+	if status := authRequest(t, "POST", baseURL+"/auth/tokens", widget.Token, body, nil); status != http.StatusForbidden {
+		t.Errorf("Expected scoped token to be unable to mint tokens, got %d", status)
+	}
+
+	if status := authRequest(t, "POST", baseURL+"/auth/tokens", full, map[string]interface{}{"scopes": []string{"admin"}}, nil); status != http.StatusForbidden {
+		t.Errorf("Expected student to be refused the admin scope, got %d", status)
+	}
+	if status := authRequest(t, "POST", baseURL+"/auth/tokens", full, map[string]interface{}{"scopes": []string{"account"}}, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected the account scope to be refused, got %d", status)
+	}
+
+	// The scoped token shares the session it was minted from
+	if status := authRequest(t, "POST", baseURL+"/auth/logout", full, nil, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 logging out, got %d", status)
+	}
+	if status := authRequest(t, "GET", baseURL+"/user/dashboard", widget.Token, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected scoped token to die with its session, got %d", status)
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	student := login(t, baseURL, "john@example.com", "password123")
+	tutor := login(t, baseURL, "jane@example.com", "password456")
+
+	var jane struct {
+		ID uint
+	}
+	db.Table("users").Select("id").Where("email = ?", "jane@example.com").Scan(&jane)
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Hour)
+	past := map[string]interface{}{"tutorId": jane.ID, "startTime": start.Add(-72 * time.Hour), "endTime": start.Add(-71 * time.Hour)}
+	if status := authRequest(t, "POST", baseURL+"/sessions", student, past, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected a session in the past to be rejected, got %d", status)
+	}
+
+	var session struct {
+		ID            uint   `json:"id"`
+		Status        string `json:"status"`
+		Price         int64  `json:"price"`
+		RequestedByID uint   `json:"requestedById"`
+	}
+	body := map[string]interface{}{"tutorId": jane.ID, "startTime": start, "endTime": start.Add(90 * time.Minute)}
+	if status := authRequest(t, "POST", baseURL+"/sessions", student, body, &session); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 requesting session, got %d", status)
+	}
+	if session.Status != "requested" || session.Price != 7500 {
+		t.Errorf("Expected a requested session priced 7500, got %+v", session)
+	}
+	sessionURL := fmt.Sprintf("%s/sessions/%d", baseURL, session.ID)
+
+	if status := authRequest(t, "POST", sessionURL+"/confirm", student, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Expected the requester to be unable to confirm, got %d", status)
+	}
+	if status := authRequest(t, "POST", sessionURL+"/confirm", tutor, nil, &session); status != http.StatusOK || session.Status != "confirmed" {
+		t.Fatalf("Expected tutor to confirm the session, got %d (%s)", status, session.Status)
+	}
+	if status := authRequest(t, "POST", sessionURL+"/confirm", tutor, nil, nil); status != http.StatusConflict {
+		t.Errorf("Expected confirming twice to conflict, got %d", status)
+	}
+
+	// Each side sees only the other's public details
+	var participants struct {
+		Tutor   map[string]interface{} `json:"tutor"`
+		Student map[string]interface{} `json:"student"`
+	}
+	authRequest(t, "GET", sessionURL, student, nil, &participants)
+	if participants.Tutor["name"] != "Jane Smith" || participants.Tutor["email"] != nil || participants.Student["email"] != nil {
+		t.Errorf("Expected only public details of the participants, got %+v", participants)
+	}
+	if status := authRequest(t, "POST", sessionURL+"/complete", tutor, nil, nil); status != http.StatusConflict {
+		t.Errorf("Expected completing a future session to conflict, got %d", status)
+	}
+
+	// Rescheduling needs confirmation from the other party again
+	reschedule := map[string]interface{}{"startTime": start.Add(24 * time.Hour), "endTime": start.Add(25 * time.Hour)}
+	if status := authRequest(t, "POST", sessionURL+"/reschedule", tutor, reschedule, &session); status != http.StatusOK {
+		t.Fatalf("Expected status 200 rescheduling, got %d", status)
+	}
+	if session.Status != "requested" || session.RequestedByID != jane.ID || session.Price != 5000 {
+		t.Errorf("Expected a requested session priced 5000 proposed by the tutor, got %+v", session)
+	}
+	if status := authRequest(t, "POST", sessionURL+"/confirm", student, nil, &session); status != http.StatusOK || session.Status != "confirmed" {
+		t.Fatalf("Expected student to confirm the new time, got %d (%s)", status, session.Status)
+	}
+
+	var dashboard struct {
+		UpcomingSessions []struct {
+			ID uint `json:"id"`
+		} `json:"upcomingSessions"`
+	}
+	if status := authRequest(t, "GET", baseURL+"/user/dashboard", student, nil, &dashboard); status != http.StatusOK {
+		t.Fatalf("Expected status 200 fetching dashboard, got %d", status)
+	}
+	if len(dashboard.UpcomingSessions) == 0 || dashboard.UpcomingSessions[0].ID != session.ID {
+		t.Errorf("Expected the session on the dashboard, got %+v", dashboard.UpcomingSessions)
+	}
+
+	if status := authRequest(t, "POST", sessionURL+"/cancel", student, map[string]interface{}{"reason": "Exam moved"}, &session); status != http.StatusOK || session.Status != "cancelled" {
+		t.Fatalf("Expected student to cancel the session, got %d (%s)", status, session.Status)
+	}
+	if status := authRequest(t, "POST", sessionURL+"/reschedule", student, reschedule, nil); status != http.StatusConflict {
+		t.Errorf("Expected rescheduling a cancelled session to conflict, got %d", status)
+	}
+
+	// A session an admin books for a student still needs the tutor's agreement
+	var john struct {
+		ID uint
+	}
+	db.Table("users").Select("id").Where("email = ?", "john@example.com").Scan(&john)
+	admin := login(t, baseURL, "admin@example.com", "password789")
+	onBehalf := map[string]interface{}{"tutorId": jane.ID, "studentId": john.ID, "startTime": start.Add(48 * time.Hour), "endTime": start.Add(49 * time.Hour)}
+	if status := authRequest(t, "POST", baseURL+"/sessions", admin, onBehalf, &session); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 booking on behalf of a student, got %d", status)
+	}
+	sessionURL = fmt.Sprintf("%s/sessions/%d", baseURL, session.ID)
+	if status := authRequest(t, "POST", sessionURL+"/confirm", student, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Expected the student to be unable to confirm a booking made for them, got %d", status)
+	}
+	if status := authRequest(t, "POST", sessionURL+"/confirm", tutor, nil, &session); status != http.StatusOK || session.Status != "confirmed" {
+		t.Errorf("Expected the tutor to confirm the admin's booking, got %d (%s)", status, session.Status)
+	}
+}
+
+func TestTutorAvailability(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	student := login(t, baseURL, "john@example.com", "password123")
+	tutor := login(t, baseURL, "jane@example.com", "password456")
+
+	var jane struct {
+		ID      uint
+		TutorID uint
+	}
+	db.Table("users").Select("users.id, tutors.id AS tutor_id").
+		Joins("JOIN tutors ON tutors.user_id = users.id").
+		Where("users.email = ?", "jane@example.com").Scan(&jane)
+	availabilityURL := fmt.Sprintf("%s/tutors/%d/availability", baseURL, jane.TutorID)
+
+	windows := make([]map[string]interface{}, 7)
+	for day := range windows {
+		windows[day] = map[string]interface{}{"weekday": day, "start": "09:00", "end": "12:00"}
+	}
+	body := map[string]interface{}{"timeZone": "Europe/London", "windows": windows}
+	if status := authRequest(t, "PUT", availabilityURL, student, body, nil); status != http.StatusForbidden {
+		t.Errorf("Expected a student to be unable to set availability, got %d", status)
+	}
+	if status := authRequest(t, "PUT", availabilityURL, tutor, map[string]interface{}{"timeZone": "Mars/Olympus"}, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected an unknown time zone to be rejected, got %d", status)
+	}
+	if status := authRequest(t, "PUT", availabilityURL, tutor, body, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 setting availability, got %d", status)
+	}
+
+	london, _ := time.LoadLocation("Europe/London")
+	day := time.Now().In(london).AddDate(0, 0, 10)
+	date := day.Format("2006-01-02")
+	nextDate := day.AddDate(0, 0, 1).Format("2006-01-02")
+	var availability struct {
+		TimeZone string `json:"timeZone"`
+		Slots    []struct {
+			Start time.Time `json:"start"`
+			End   time.Time `json:"end"`
+		} `json:"slots"`
+	}
+	query := "?from=" + date + "&to=" + nextDate
+	if status := authRequest(t, "GET", availabilityURL+query, student, nil, &availability); status != http.StatusOK {
+		t.Fatalf("Expected status 200 fetching availability, got %d", status)
+	}
+	if availability.TimeZone != "Europe/London" || len(availability.Slots) != 5 {
+		t.Fatalf("Expected 5 hourly slots in Europe/London, got %+v", availability)
+	}
+	first := availability.Slots[0].Start
+	if local := first.In(london); local.Hour() != 9 || local.Minute() != 0 {
+		t.Errorf("Expected the first slot at 09:00 local time, got %s", local)
+	}
+
+	// A requested session and a blackout both take time out of the day
+	session := map[string]interface{}{"tutorId": jane.ID, "startTime": first, "endTime": first.Add(time.Hour)}
+	if status := authRequest(t, "POST", baseURL+"/sessions", student, session, nil); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 requesting session, got %d", status)
+	}
+	blackout := map[string]interface{}{"startTime": first.Add(2 * time.Hour), "endTime": first.Add(3 * time.Hour), "reason": "Dentist"}
+	if status := authRequest(t, "POST", availabilityURL+"/exceptions", tutor, blackout, nil); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 adding a blackout, got %d", status)
+	}
+	if status := authRequest(t, "GET", availabilityURL+query, student, nil, &availability); status != http.StatusOK {
+		t.Fatalf("Expected status 200 fetching availability, got %d", status)
+	}
+	if len(availability.Slots) != 1 || !availability.Slots[0].Start.Equal(first.Add(time.Hour)) {
+		t.Errorf("Expected only the 10:00 slot to remain, got %+v", availability.Slots)
+	}
+}
+
+func TestConcurrentBooking(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	student := login(t, baseURL, "john@example.com", "password123")
+
+	var jane struct {
+		ID uint
+	}
+	db.Table("users").Select("id").Where("email = ?", "jane@example.com").Scan(&jane)
+
+	start := time.Now().Add(20 * 24 * time.Hour).Truncate(time.Hour)
+	body := map[string]interface{}{"tutorId": jane.ID, "startTime": start, "endTime": start.Add(time.Hour)}
+
+	const attempts = 10
+	statuses := make([]int, attempts)
+	holds := make([]struct {
+		ID     uint   `json:"id"`
+		Status string `json:"status"`
+	}, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i] = authRequest(t, "POST", baseURL+"/sessions/hold", student, body, &holds[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var held uint
+	for i, status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			if held != 0 {
+				t.Fatalf("Expected one hold on the slot, got sessions %d and %d", held, holds[i].ID)
+			}
+			held = holds[i].ID
+		case http.StatusConflict:
+		default:
+			t.Errorf("Expected status 201 or 409 holding the slot, got %d", status)
+		}
+	}
+	if held == 0 {
+		t.Fatalf("Expected one hold to succeed, got %v", statuses)
+	}
+
+	// Overlapping requests are rejected too, not just identical slots
+	overlap := map[string]interface{}{"tutorId": jane.ID, "startTime": start.Add(30 * time.Minute), "endTime": start.Add(90 * time.Minute)}
+	if status := authRequest(t, "POST", baseURL+"/sessions", student, overlap, nil); status != http.StatusConflict {
+		t.Errorf("Expected an overlapping request to conflict, got %d", status)
+	}
+
+	var session struct {
+		Status string `json:"status"`
+	}
+	if status := authRequest(t, "POST", fmt.Sprintf("%s/sessions/%d/book", baseURL, held), student, nil, &session); status != http.StatusOK || session.Status != "requested" {
+		t.Fatalf("Expected the hold to be booked, got %d (%s)", status, session.Status)
+	}
+
+	// A lapsed hold frees its slot for the next student
+	start = start.Add(2 * time.Hour)
+	body = map[string]interface{}{"tutorId": jane.ID, "startTime": start, "endTime": start.Add(time.Hour)}
+	var hold struct {
+		ID uint `json:"id"`
+	}
+	if status := authRequest(t, "POST", baseURL+"/sessions/hold", student, body, &hold); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 holding the slot, got %d", status)
+	}
+	db.Table("sessions").Where("id = ?", hold.ID).Update("hold_expires_at", time.Now().Add(-time.Minute))
+	if status := authRequest(t, "POST", baseURL+"/sessions/hold", student, body, nil); status != http.StatusCreated {
+		t.Errorf("Expected the expired hold to free the slot, got %d", status)
+	}
+	if status := authRequest(t, "POST", fmt.Sprintf("%s/sessions/%d/book", baseURL, hold.ID), student, nil, nil); status != http.StatusConflict {
+		t.Errorf("Expected booking an expired hold to conflict, got %d", status)
+	}
+}
+
+func TestSessionSeries(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	student := login(t, baseURL, "john@example.com", "password123")
+
+	var jane struct {
+		ID uint
+	}
+	db.Table("users").Select("id").Where("email = ?", "jane@example.com").Scan(&jane)
+
+	// Occurrences keep their wall-clock time in the tutor's time zone
+	var zone string
+	db.Table("tutors").Select("time_zone").Where("user_id = ?", jane.ID).Scan(&zone)
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		t.Fatalf("Error loading tutor time zone: %v", err)
+	}
+
+	type seriesResponse struct {
+		Series struct {
+			ID    uint `json:"id"`
+			Count *int `json:"count"`
+		} `json:"series"`
+		Sessions []struct {
+			ID        uint      `json:"id"`
+			StartTime time.Time `json:"startTime"`
+			Status    string    `json:"status"`
+		} `json:"sessions"`
+	}
+
+	start := time.Now().Add(40 * 24 * time.Hour).Truncate(time.Hour).In(loc)
+	body := map[string]interface{}{
+		"tutorId":   jane.ID,
+		"startTime": start,
+		"endTime":   start.Add(time.Hour),
+		"frequency": "weekly",
+		"count":     4,
+	}
+	var created seriesResponse
+	if status := authRequest(t, "POST", baseURL+"/sessions/series", student, body, &created); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 booking a series, got %d", status)
+	}
+	if len(created.Sessions) != 4 || !created.Sessions[3].StartTime.Equal(start.AddDate(0, 0, 21)) {
+		t.Fatalf("Expected 4 weekly sessions, got %+v", created.Sessions)
+	}
+
+	var conflict struct {
+		Conflicts []time.Time `json:"conflicts"`
+	}
+	clash := map[string]interface{}{
+		"tutorId":   jane.ID,
+		"startTime": start.AddDate(0, 0, -14),
+		"endTime":   start.AddDate(0, 0, -14).Add(time.Hour),
+		"frequency": "biweekly",
+		"until":     start.AddDate(0, 0, 14),
+	}
+	if status := authRequest(t, "POST", baseURL+"/sessions/series", student, clash, &conflict); status != http.StatusConflict {
+		t.Fatalf("Expected a clashing series to conflict, got %d", status)
+	}
+	if len(conflict.Conflicts) != 2 {
+		t.Errorf("Expected 2 clashing dates, got %v", conflict.Conflicts)
+	}
+
+	var dashboard struct {
+		UpcomingSessions []struct {
+			ID        uint   `json:"id"`
+			SeriesID  uint   `json:"seriesId"`
+			Frequency string `json:"frequency"`
+			Remaining int    `json:"remaining"`
+		} `json:"upcomingSessions"`
+	}
+	if status := authRequest(t, "GET", baseURL+"/user/dashboard", student, nil, &dashboard); status != http.StatusOK {
+		t.Fatalf("Expected status 200 fetching dashboard, got %d", status)
+	}
+	var listed int
+	for _, s := range dashboard.UpcomingSessions {
+		if s.SeriesID == created.Series.ID {
+			listed++
+			if s.ID != created.Sessions[0].ID || s.Frequency != "weekly" || s.Remaining != 4 {
+				t.Errorf("Expected the series' next session with 4 remaining, got %+v", s)
+			}
+		}
+	}
+	if listed != 1 {
+		t.Errorf("Expected the series once on the dashboard, got %d entries", listed)
+	}
+
+	// Moving the third session and the ones after it splits the series
+	third := fmt.Sprintf("%s/sessions/%d", baseURL, created.Sessions[2].ID)
+	moved := created.Sessions[2].StartTime.In(loc).AddDate(0, 0, 1).Add(time.Hour)
+	reschedule := map[string]interface{}{"startTime": moved, "endTime": moved.Add(time.Hour), "applyTo": "following"}
+	var tail seriesResponse
+	if status := authRequest(t, "POST", third+"/reschedule", student, reschedule, &tail); status != http.StatusOK {
+		t.Fatalf("Expected status 200 rescheduling following sessions, got %d", status)
+	}
+	if tail.Series.ID == created.Series.ID || tail.Series.Count == nil || *tail.Series.Count != 2 || len(tail.Sessions) != 2 {
+		t.Fatalf("Expected a new series of 2 sessions, got %+v", tail)
+	}
+	if !tail.Sessions[1].StartTime.Equal(moved.AddDate(0, 0, 7)) {
+		t.Errorf("Expected the fourth session to move with the third, got %s", tail.Sessions[1].StartTime)
+	}
+
+	var head seriesResponse
+	if status := authRequest(t, "GET", fmt.Sprintf("%s/sessions/series/%d", baseURL, created.Series.ID), student, nil, &head); status != http.StatusOK {
+		t.Fatalf("Expected status 200 fetching series, got %d", status)
+	}
+	if head.Series.Count == nil || *head.Series.Count != 2 || len(head.Sessions) != 2 {
+		t.Errorf("Expected the original series to end after 2 sessions, got %+v", head)
+	}
+
+	// Cancelling one occurrence leaves the rest of the series alone
+	first := fmt.Sprintf("%s/sessions/%d", baseURL, created.Sessions[0].ID)
+	if status := authRequest(t, "POST", first+"/cancel", student, map[string]interface{}{"applyTo": "this"}, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 cancelling one session, got %d", status)
+	}
+	if status := authRequest(t, "GET", fmt.Sprintf("%s/sessions/series/%d", baseURL, created.Series.ID), student, nil, &head); status != http.StatusOK {
+		t.Fatalf("Expected status 200 fetching series, got %d", status)
+	}
+	if head.Sessions[0].Status != "cancelled" || head.Sessions[1].Status != "requested" {
+		t.Errorf("Expected only the first session to be cancelled, got %+v", head.Sessions)
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	student := login(t, baseURL, "john@example.com", "password123")
+	tutor := login(t, baseURL, "jane@example.com", "password456")
+
+	var jane struct {
+		ID uint
+	}
+	db.Table("users").Select("id").Where("email = ?", "jane@example.com").Scan(&jane)
+
+	fetch := func(url string) (int, http.Header, string) {
+		t.Helper()
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("Error fetching %s: %v", url, err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header, string(body)
+	}
+
+	start := time.Now().Add(60 * 24 * time.Hour).Truncate(time.Hour)
+	var session struct {
+		ID uint `json:"id"`
+	}
+	body := map[string]interface{}{"tutorId": jane.ID, "startTime": start, "endTime": start.Add(time.Hour)}
+	if status := authRequest(t, "POST", baseURL+"/sessions", student, body, &session); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 requesting session, got %d", status)
+	}
+	uid := fmt.Sprintf("UID:session-%d@tutor-api\r\n", session.ID)
+
+	var feed struct {
+		URL string `json:"url"`
+	}
+	if status := authRequest(t, "POST", baseURL+"/user/calendar", tutor, nil, &feed); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating calendar feed, got %d", status)
+	}
+	status, header, ics := fetch(feed.URL)
+	if status != http.StatusOK || !strings.HasPrefix(header.Get("Content-Type"), "text/calendar") {
+		t.Fatalf("Expected an iCalendar feed, got %d (%s)", status, header.Get("Content-Type"))
+	}
+	if !strings.Contains(ics, uid) || !strings.Contains(ics, "STATUS:TENTATIVE\r\n") || !strings.Contains(ics, "BEGIN:VTIMEZONE\r\n") {
+		t.Errorf("Expected the requested session in the feed, got:\n%s", ics)
+	}
+
+	// Rescheduling keeps the UID and bumps the sequence
+	sessionURL := fmt.Sprintf("%s/sessions/%d", baseURL, session.ID)
+	reschedule := map[string]interface{}{"startTime": start.Add(24 * time.Hour), "endTime": start.Add(25 * time.Hour)}
+	if status := authRequest(t, "POST", sessionURL+"/reschedule", tutor, reschedule, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 rescheduling, got %d", status)
+	}
+	if status := authRequest(t, "POST", sessionURL+"/cancel", student, nil, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 cancelling, got %d", status)
+	}
+	_, _, ics = fetch(feed.URL)
+	if !strings.Contains(ics, uid) || !strings.Contains(ics, "SEQUENCE:2\r\n") || !strings.Contains(ics, "STATUS:CANCELLED\r\n") {
+		t.Errorf("Expected the cancelled session at sequence 2 in the feed, got:\n%s", ics)
+	}
+
+	req, _ := http.NewRequest("GET", sessionURL+".ics", nil)
+	req.Header.Set("Authorization", "Bearer "+student)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error downloading session: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Disposition"), "session-") {
+		t.Errorf("Expected the session as an .ics download, got %d (%s)", resp.StatusCode, resp.Header.Get("Content-Disposition"))
+	}
+
+	// A new URL replaces the old one
+	if status := authRequest(t, "POST", baseURL+"/user/calendar", tutor, nil, nil); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 rotating calendar feed, got %d", status)
+	}
+	if status, _, _ := fetch(feed.URL); status != http.StatusNotFound {
+		t.Errorf("Expected the old feed URL to stop working, got %d", status)
+	}
+
+	// Logging out everywhere revokes the feed URL as well
+	verifiedAt := time.Now()
+	user := models.User{Name: "Feed Owner", Email: "feed-owner@example.com", Password: "password123", UserType: "student", EmailVerifiedAt: &verifiedAt}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Error creating feed owner: %v", err)
+	}
+	owner := login(t, baseURL, user.Email, "password123")
+	if status := authRequest(t, "POST", baseURL+"/user/calendar", owner, nil, &feed); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating calendar feed, got %d", status)
+	}
+	if status := authRequest(t, "POST", baseURL+"/auth/logout-all", owner, nil, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 logging out everywhere, got %d", status)
+	}
+	if status, _, _ := fetch(feed.URL); status != http.StatusNotFound {
+		t.Errorf("Expected the feed URL to stop working after logging out everywhere, got %d", status)
+	}
+}
+
+func TestUserTimeZone(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	student := login(t, baseURL, "john@example.com", "password123")
+
+	var jane struct {
+		ID uint
+	}
+	db.Table("users").Select("id").Where("email = ?", "jane@example.com").Scan(&jane)
+
+	if status := authRequest(t, "PUT", baseURL+"/user/time-zone", student, map[string]interface{}{"timeZone": "Local"}, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected the server's local zone to be rejected, got %d", status)
+	}
+	if status := authRequest(t, "PUT", baseURL+"/user/time-zone", student, map[string]interface{}{"timeZone": "Asia/Kolkata"}, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 setting time zone, got %d", status)
+	}
+	defer authRequest(t, "PUT", baseURL+"/user/time-zone", student, map[string]interface{}{"timeZone": "UTC"}, nil)
+
+	start := time.Now().Add(70 * 24 * time.Hour).Truncate(time.Hour).UTC()
+	body := map[string]interface{}{"tutorId": jane.ID, "startTime": start, "endTime": start.Add(time.Hour)}
+	var session struct {
+		ID        uint   `json:"id"`
+		StartTime string `json:"startTime"`
+	}
+	if status := authRequest(t, "POST", baseURL+"/sessions", student, body, &session); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 requesting session, got %d", status)
+	}
+
+	// Kolkata is UTC+05:30 all year round
+	want := start.In(time.FixedZone("IST", 330*60)).Format(time.RFC3339)
+	if session.StartTime != want {
+		t.Errorf("Expected startTime %s in the student's zone, got %s", want, session.StartTime)
+	}
+
+	var fetched struct {
+		StartTime string `json:"startTime"`
+	}
+	if status := authRequest(t, "GET", fmt.Sprintf("%s/sessions/%d", baseURL, session.ID), student, nil, &fetched); status != http.StatusOK || fetched.StartTime != want {
+		t.Errorf("Expected startTime %s fetching the session, got %d (%s)", want, status, fetched.StartTime)
+	}
+
+	var dashboard struct {
+		UpcomingSessions []struct {
+			Datetime string `json:"datetime"`
+		} `json:"upcomingSessions"`
+	}
+	if status := authRequest(t, "GET", baseURL+"/user/dashboard", student, nil, &dashboard); status != http.StatusOK {
+		t.Fatalf("Expected status 200 fetching dashboard, got %d", status)
+	}
+	for _, s := range dashboard.UpcomingSessions {
+		if !strings.HasSuffix(s.Datetime, "+05:30") {
+			t.Errorf("Expected dashboard times with a +05:30 offset, got %s", s.Datetime)
+		}
+	}
+}
+
+func TestTutoringRequests(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	student := login(t, baseURL, "john@example.com", "password123")
+	tutor := login(t, baseURL, "jane@example.com", "password456")
+
+	var jane struct {
+		ID uint
+	}
+	db.Table("users").Select("id").Where("email = ?", "jane@example.com").Scan(&jane)
+
+	type requestResponse struct {
+		ID          uint   `json:"id"`
+		TutorID     *uint  `json:"tutorId"`
+		Status      string `json:"status"`
+		CounterRate *int64 `json:"counterRate"`
+		ChatID      *uint  `json:"chatId"`
+		SessionID   *uint  `json:"sessionId"`
+	}
+
+	start := time.Now().Add(60 * 24 * time.Hour).Truncate(time.Hour)
+	body := map[string]interface{}{
+		"tutorId":        jane.ID,
+		"subject":        "Mathematics",
+		"budget":         3000,
+		"preferredTimes": []map[string]time.Time{{"start": start, "end": start.Add(time.Hour)}},
+		"message":        "GCSE revision",
+	}
+	var targeted requestResponse
+	if status := authRequest(t, "POST", baseURL+"/requests", student, body, &targeted); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating a request, got %d", status)
+	}
+
+	var dashboard struct {
+		Requests []struct {
+			ID     uint  `json:"id"`
+			Budget int64 `json:"budget"`
+		} `json:"requests"`
+	}
+	authRequest(t, "GET", baseURL+"/user/dashboard", tutor, nil, &dashboard)
+	if len(dashboard.Requests) != 1 || dashboard.Requests[0].ID != targeted.ID || dashboard.Requests[0].Budget != 3000 {
+		t.Errorf("Expected the request on the tutor dashboard, got %+v", dashboard.Requests)
+	}
+
+	// Only the student can answer a counter-offer
+	var countered requestResponse
+	counter := map[string]interface{}{"rate": 4000, "message": "My rate is £40"}
+	if status := authRequest(t, "POST", fmt.Sprintf("%s/requests/%d/counter", baseURL, targeted.ID), tutor, counter, &countered); status != http.StatusOK {
+		t.Fatalf("Expected status 200 countering, got %d", status)
+	}
+	if countered.Status != "countered" || countered.CounterRate == nil || *countered.CounterRate != 4000 {
+		t.Errorf("Expected a counter-offer of 4000, got %+v", countered)
+	}
+	if status := authRequest(t, "POST", fmt.Sprintf("%s/requests/%d/accept", baseURL, targeted.ID), tutor, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 when the tutor accepts their own counter-offer, got %d", status)
+	}
+
+	var accepted requestResponse
+	slot := map[string]interface{}{"startTime": start, "endTime": start.Add(90 * time.Minute)}
+	if status := authRequest(t, "POST", fmt.Sprintf("%s/requests/%d/accept", baseURL, targeted.ID), student, slot, &accepted); status != http.StatusOK {
+		t.Fatalf("Expected status 200 accepting the counter-offer, got %d", status)
+	}
+	if accepted.Status != "accepted" || accepted.ChatID == nil || accepted.SessionID == nil {
+		t.Fatalf("Expected acceptance to open a chat and a session, got %+v", accepted)
+	}
+
+	var session struct {
+		Price  int64  `json:"price"`
+		Status string `json:"status"`
+	}
+	authRequest(t, "GET", fmt.Sprintf("%s/sessions/%d", baseURL, *accepted.SessionID), tutor, nil, &session)
+	if session.Price != 6000 || session.Status != "requested" {
+		t.Errorf("Expected a requested session at the countered rate, got %+v", session)
+	}
+	if status := authRequest(t, "GET", fmt.Sprintf("%s/chats/%d", baseURL, *accepted.ChatID), tutor, nil, nil); status != http.StatusOK {
+		t.Errorf("Expected the tutor to see the new chat, got %d", status)
+	}
+	if status := authRequest(t, "POST", fmt.Sprintf("%s/requests/%d/withdraw", baseURL, targeted.ID), student, nil, nil); status != http.StatusConflict {
+		t.Errorf("Expected status 409 withdrawing an accepted request, got %d", status)
+	}
+
+	// Open requests are on the board for any tutor to take
+	open := start.AddDate(0, 0, 1)
+	body = map[string]interface{}{
+		"subject":        "Physics",
+		"budget":         2500,
+		"preferredTimes": []map[string]time.Time{{"start": open, "end": open.Add(time.Hour)}},
+	}
+	var posted requestResponse
+	if status := authRequest(t, "POST", baseURL+"/requests", student, body, &posted); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 posting to the board, got %d", status)
+	}
+	if status := authRequest(t, "GET", baseURL+"/requests?board=true", student, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a student viewing the board, got %d", status)
+	}
+
+	var board []requestResponse
+	authRequest(t, "GET", baseURL+"/requests?board=true", tutor, nil, &board)
+	if len(board) != 1 || board[0].ID != posted.ID {
+		t.Fatalf("Expected the open request on the board, got %+v", board)
+	}
+	if status := authRequest(t, "POST", fmt.Sprintf("%s/requests/%d/decline", baseURL, posted.ID), tutor, nil, nil); status != http.StatusConflict {
+		t.Errorf("Expected status 409 declining an open request, got %d", status)
+	}
+
+	// Browsing tutors only see the student's public details
+	var listed []struct {
+		Student map[string]interface{} `json:"student"`
+	}
+	authRequest(t, "GET", baseURL+"/requests?board=true", tutor, nil, &listed)
+	if len(listed) != 1 || listed[0].Student["name"] != "John Doe" || listed[0].Student["email"] != nil {
+		t.Errorf("Expected only the student's name on the board, got %+v", listed)
+	}
+
+	unverified := models.User{Name: "Unverified Tutor", Email: "unverified-requests@example.com", Password: "password123", UserType: "tutor"}
+	if err := db.Create(&unverified).Error; err != nil {
+		t.Fatalf("Error creating tutor user: %v", err)
+	}
+	stranger := login(t, baseURL, unverified.Email, "password123")
+	if status := authRequest(t, "POST", fmt.Sprintf("%s/requests/%d/accept", baseURL, posted.ID), stranger, nil, nil); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 when an unverified tutor accepts, got %d", status)
+	}
+
+	// Picking one of the student's preferred times confirms the session
+	var claimed requestResponse
+	slot = map[string]interface{}{"startTime": open, "endTime": open.Add(time.Hour), "createChat": false}
+	if status := authRequest(t, "POST", fmt.Sprintf("%s/requests/%d/accept", baseURL, posted.ID), tutor, slot, &claimed); status != http.StatusOK {
+		t.Fatalf("Expected status 200 taking an open request, got %d", status)
+	}
+	if claimed.TutorID == nil || *claimed.TutorID != jane.ID || claimed.ChatID != nil || claimed.SessionID == nil {
+		t.Fatalf("Expected the tutor to claim the request without a chat, got %+v", claimed)
+	}
+	authRequest(t, "GET", fmt.Sprintf("%s/sessions/%d", baseURL, *claimed.SessionID), student, nil, &session)
+	if session.Price != 2500 || session.Status != "confirmed" {
+		t.Errorf("Expected a confirmed session at the budget, got %+v", session)
+	}
+
+	board = nil
+	authRequest(t, "GET", baseURL+"/requests?board=true", tutor, nil, &board)
+	if len(board) != 0 {
+		t.Errorf("Expected the board to be empty, got %+v", board)
+	}
+}
+
+func TestSubjectCatalogue(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	student := login(t, baseURL, "john@example.com", "password123")
+	tutor := login(t, baseURL, "jane@example.com", "password456")
+	admin := login(t, baseURL, "admin@example.com", "password789")
+
+	type subjectResponse struct {
+		ID       uint              `json:"id"`
+		Path     string            `json:"path"`
+		Children []subjectResponse `json:"children"`
+	}
+
+	var maths, gcse subjectResponse
+	if status := authRequest(t, "POST", baseURL+"/admin/subjects", student, map[string]interface{}{"name": "Maths"}, nil); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a student creating a subject, got %d", status)
+	}
+	if status := authRequest(t, "POST", baseURL+"/admin/subjects", admin, map[string]interface{}{"name": "Maths"}, &maths); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating a subject, got %d", status)
+	}
+	authRequest(t, "POST", baseURL+"/admin/subjects", admin, map[string]interface{}{"name": "GCSE", "parentId": maths.ID}, &gcse)
+	if gcse.Path != "Maths > GCSE" {
+		t.Fatalf("Expected path Maths > GCSE, got %q", gcse.Path)
+	}
+	if status := authRequest(t, "POST", baseURL+"/admin/subjects", admin, map[string]interface{}{"name": "gcse", "parentId": maths.ID}, nil); status != http.StatusConflict {
+		t.Errorf("Expected status 409 for a duplicate subject, got %d", status)
+	}
+	if status := authRequest(t, "PUT", fmt.Sprintf("%s/admin/subjects/%d", baseURL, maths.ID), admin, map[string]interface{}{"name": "Maths", "parentId": gcse.ID}, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 moving a subject beneath itself, got %d", status)
+	}
+
+	var tree []subjectResponse
+	authRequest(t, "GET", baseURL+"/subjects?tree=true&q=maths", student, nil, &tree)
+	if len(tree) != 1 || len(tree[0].Children) != 1 || tree[0].Children[0].ID != gcse.ID {
+		t.Errorf("Expected GCSE nested under Maths, got %+v", tree)
+	}
+
+	var jane struct {
+		ID      uint
+		TutorID uint
+	}
+	db.Table("users").Select("users.id, tutors.id AS tutor_id").
+		Joins("JOIN tutors ON tutors.user_id = users.id").
+		Where("users.email = ?", "jane@example.com").Scan(&jane)
+
+	type profileSubjects struct {
+		Subjects []struct {
+			SubjectID  uint   `json:"subjectId"`
+			HourlyRate *int64 `json:"hourlyRate"`
+			Subject    struct {
+				Path string `json:"path"`
+			} `json:"subject"`
+		} `json:"subjects"`
+	}
+	subjectsURL := fmt.Sprintf("%s/tutors/%d/subjects", baseURL, jane.TutorID)
+	body := map[string]interface{}{"subjects": []map[string]interface{}{
+		{"subjectId": gcse.ID, "hourlyRate": 4500, "level": "Higher tier"},
+		{"subjectId": maths.ID},
+	}}
+	if status := authRequest(t, "PUT", subjectsURL, student, body, nil); status != http.StatusForbidden {
+		t.Errorf("Expected status 403 setting another tutor's subjects, got %d", status)
+	}
+	unknown := map[string]interface{}{"subjects": []map[string]interface{}{{"subjectId": 999999}}}
+	if status := authRequest(t, "PUT", subjectsURL, tutor, unknown, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown subject, got %d", status)
+	}
+	var taught profileSubjects
+	if status := authRequest(t, "PUT", subjectsURL, tutor, body, &taught); status != http.StatusOK {
+		t.Fatalf("Expected status 200 setting subjects, got %d", status)
+	}
+	if len(taught.Subjects) != 2 || taught.Subjects[1].Subject.Path != "Maths > GCSE" {
+		t.Errorf("Expected both subjects ordered by path, got %+v", taught.Subjects)
+	}
+
+	// Renaming a subject renames the branch beneath it
+	if status := authRequest(t, "PUT", fmt.Sprintf("%s/admin/subjects/%d", baseURL, maths.ID), admin, map[string]interface{}{"name": "Mathematics"}, nil); status != http.StatusOK {
+		t.Fatalf("Expected status 200 renaming a subject, got %d", status)
+	}
+	authRequest(t, "GET", fmt.Sprintf("%s/subjects/%d", baseURL, gcse.ID), student, nil, &gcse)
+	if gcse.Path != "Mathematics > GCSE" {
+		t.Errorf("Expected path Mathematics > GCSE, got %q", gcse.Path)
+	}
+
+	// Sessions in the subject are priced at its rate
+	start := time.Now().Add(80 * 24 * time.Hour).Truncate(time.Hour)
+	var session struct {
+		Price int64 `json:"price"`
+	}
+	booking := map[string]interface{}{"tutorId": jane.ID, "subject": "mathematics > gcse", "startTime": start, "endTime": start.Add(2 * time.Hour)}
+	if status := authRequest(t, "POST", baseURL+"/sessions", student, booking, &session); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 booking a session, got %d", status)
+	}
+	if session.Price != 9000 {
+		t.Errorf("Expected the subject's rate for 2 hours, 9000, got %d", session.Price)
+	}
+
+	if status := authRequest(t, "DELETE", fmt.Sprintf("%s/admin/subjects/%d", baseURL, gcse.ID), admin, nil, nil); status != http.StatusConflict {
+		t.Errorf("Expected status 409 deleting a subject in use, got %d", status)
+	}
+	authRequest(t, "PUT", subjectsURL, tutor, map[string]interface{}{"subjects": []interface{}{}}, nil)
+	if status := authRequest(t, "DELETE", fmt.Sprintf("%s/admin/subjects/%d", baseURL, gcse.ID), admin, nil, nil); status != http.StatusNoContent {
+		t.Errorf("Expected status 204 deleting an unused subject, got %d", status)
+	}
+}
+
+func TestTutorSearch(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	student := login(t, baseURL, "john@example.com", "password123")
+
+	// Profiles in their own town, so other tests' tutors stay out of the way
+	science := models.Subject{Name: "Search Science", Path: "Search Science"}
+	db.Create(&science)
+	physics := models.Subject{ParentID: &science.ID, Name: "Physics", Path: "Search Science > Physics"}
+	db.Create(&physics)
+
+	fixtures := []struct {
+		name       string
+		rate       float64
+		experience int
+		subject    uint
+	}{
+		{"North", 20, 2, physics.ID},
+		{"South", 40, 10, physics.ID},
+		{"East", 60, 5, science.ID},
+	}
+	tutors := make([]models.Tutor, len(fixtures))
+	for i, f := range fixtures {
+		user := models.User{Name: "Search " + f.name, Email: "search-" + strings.ToLower(f.name) + "@example.com", Password: "password123", UserType: "tutor"}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("Error creating tutor user: %v", err)
+		}
+		tutors[i] = models.Tutor{UserID: user.ID, Subject: "Science", YearsExperience: f.experience, HourlyRate: f.rate, Location: "Searchton " + f.name}
+		db.Create(&tutors[i])
+		db.Create(&models.TutorSubject{TutorID: tutors[i].ID, SubjectID: f.subject})
+	}
+	north, south, east := tutors[0], tutors[1], tutors[2]
+
+	type searchResponse struct {
+		Tutors []struct {
+			ID            uint
+			RatingAverage float64
+		} `json:"tutors"`
+		Total      int64  `json:"total"`
+		NextCursor string `json:"nextCursor"`
+	}
+	search := func(query string) searchResponse {
+		t.Helper()
+		var result searchResponse
+		if status := authRequest(t, "GET", baseURL+"/tutors?location=Searchton&"+query, student, nil, &result); status != http.StatusOK {
+			t.Fatalf("Expected status 200 searching with %q, got %d", query, status)
+		}
+		return result
+	}
+	ids := func(result searchResponse) []uint {
+		ids := []uint{}
+		for _, tutor := range result.Tutors {
+			ids = append(ids, tutor.ID)
+		}
+		return ids
+	}
+	expect := func(query string, want ...uint) {
+		t.Helper()
+		if got := ids(search(query)); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Searching with %q returned %v, want %v", query, got, want)
+		}
+	}
+
+	// Pages follow the cursor until the results run out
+	page := search("sort=price&limit=2")
+	if page.Total != 3 || fmt.Sprint(ids(page)) != fmt.Sprint([]uint{north.ID, south.ID}) || page.NextCursor == "" {
+		t.Fatalf("Expected the 2 cheapest of 3 tutors and a cursor, got %+v", page)
+	}
+	page = search("sort=price&limit=2&cursor=" + page.NextCursor)
+	if page.Total != 3 || fmt.Sprint(ids(page)) != fmt.Sprint([]uint{east.ID}) || page.NextCursor != "" {
+		t.Errorf("Expected the last tutor and no cursor, got %+v", page)
+	}
+	if status := authRequest(t, "GET", baseURL+"/tutors?sort=experience&cursor="+search("sort=price&limit=1").NextCursor, student, nil, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a cursor from another sort, got %d", status)
+	}
+	if status := authRequest(t, "GET", baseURL+"/tutors?sort=name", student, nil, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown sort, got %d", status)
+	}
+
+	expect("sort=-price", east.ID, south.ID, north.ID)
+	expect("sort=experience", south.ID, east.ID, north.ID)
+	expect("minPrice=30&maxPrice=50", south.ID)
+	expect("minExperience=5&sort=price", south.ID, east.ID)
+	expect(fmt.Sprintf("subjectId=%d&sort=price", science.ID), north.ID, south.ID, east.ID)
+	expect(fmt.Sprintf("subjectId=%d&sort=price", physics.ID), north.ID, south.ID)
+	expect("subject=physics&sort=price", north.ID, south.ID)
+
+	// Only tutors with a free slot in the window match
+	for weekday := 0; weekday < 7; weekday++ {
+		db.Create(&models.AvailabilityWindow{TutorID: north.ID, Weekday: weekday, StartMinute: 0, EndMinute: 24 * 60})
+	}
+	from := time.Now().Add(48 * time.Hour).UTC()
+	expect(fmt.Sprintf("availableFrom=%s&availableTo=%s", from.Format(time.RFC3339), from.Add(24*time.Hour).Format(time.RFC3339)), north.ID)
+
+	// Ratings come from reviews of completed sessions
+	var john struct {
+		ID uint
+	}
+	db.Table("users").Select("id").Where("email = ?", "john@example.com").Scan(&john)
+	ended := time.Now().Add(-48 * time.Hour).Truncate(time.Hour)
+	session := models.Session{TutorID: south.UserID, StudentID: john.ID, Subject: "Physics", StartTime: ended, EndTime: ended.Add(time.Hour),
+		Price: 4000, Status: models.SessionCompleted, RequestedByID: john.ID}
+	db.Create(&session)
+
+	reviewURL := fmt.Sprintf("%s/sessions/%d/review", baseURL, session.ID)
+	if status := authRequest(t, "POST", reviewURL, student, map[string]interface{}{"rating": 6}, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a rating above 5, got %d", status)
+	}
+	if status := authRequest(t, "POST", reviewURL, student, map[string]interface{}{"rating": 4, "comment": "Clear explanations"}, nil); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 reviewing a session, got %d", status)
+	}
+	if status := authRequest(t, "POST", reviewURL, student, map[string]interface{}{"rating": 5}, nil); status != http.StatusConflict {
+		t.Errorf("Expected status 409 reviewing a session twice, got %d", status)
+	}
+
+	expect("minRating=4", south.ID)
+	if rated := search("sort=rating"); rated.Tutors[0].ID != south.ID || rated.Tutors[0].RatingAverage != 4 {
+		t.Errorf("Expected the reviewed tutor first with a rating of 4, got %+v", rated.Tutors)
+	}
+
+	var reviews struct {
+		RatingCount int `json:"ratingCount"`
+		Reviews     []struct {
+			StudentName string `json:"studentName"`
+			Comment     string `json:"comment"`
+		} `json:"reviews"`
+	}
+	authRequest(t, "GET", fmt.Sprintf("%s/tutors/%d/reviews", baseURL, south.ID), student, nil, &reviews)
+	if reviews.RatingCount != 1 || len(reviews.Reviews) != 1 || reviews.Reviews[0].StudentName != "John Doe" {
+		t.Errorf("Expected John's review, got %+v", reviews)
+	}
+}
+
+func TestFullTextSearch(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	student := login(t, baseURL, "john@example.com", "password123")
+
+	chemistry := models.Subject{Name: "Chemistry", Path: "Chemistry"}
+	db.Where(chemistry).FirstOrCreate(&chemistry)
+
+	fixtures := []struct {
+		name, subject, headline, bio string
+	}{
+		{"Ada Organa", "Chemistry", "A-Level chemistry tutor", "I specialise in organic chemistry and reaction mechanisms."},
+		{"Ben Bunsen", "Science", "Chemistry for A-Level and GCSE", "Inorganic and physical chemistry revision."},
+		{"Cleo Keys", "Music", "Piano teacher", "Grades 1 to 8 with <b>ABRSM</b> exams."},
+	}
+	tutors := make([]models.Tutor, len(fixtures))
+	ids := make([]uint, len(fixtures))
+	for i, f := range fixtures {
+		user := models.User{Name: f.name, Email: fmt.Sprintf("fulltext-%d@example.com", i), Password: "password123", UserType: "tutor"}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("Error creating tutor user: %v", err)
+		}
+		tutors[i] = models.Tutor{UserID: user.ID, Subject: f.subject, Headline: f.headline, Bio: f.bio, YearsExperience: 3, HourlyRate: 35, Location: "Fulltextville"}
+		db.Create(&tutors[i])
+		ids[i] = tutors[i].ID
+	}
+	db.Create(&models.TutorSubject{TutorID: tutors[1].ID, SubjectID: chemistry.ID})
+	if err := models.RefreshTutorSearch(db, ids); err != nil {
+		t.Fatalf("Error indexing tutors: %v", err)
+	}
+
+	type searchResponse struct {
+		Tutors []struct {
+			ID      uint
+			Rank    float64 `json:"rank"`
+			Snippet string  `json:"snippet"`
+		} `json:"tutors"`
+		Total      int64  `json:"total"`
+		NextCursor string `json:"nextCursor"`
+	}
+	search := func(query string) searchResponse {
+		t.Helper()
+		var result searchResponse
+		if status := authRequest(t, "GET", baseURL+"/tutors/search?location=Fulltextville&"+query, student, nil, &result); status != http.StatusOK {
+			t.Fatalf("Expected status 200 searching with %q, got %d", query, status)
+		}
+		return result
+	}
+
+	// Matching more of the query ranks higher
+	result := search("q=a-level+chemistry+organic")
+	if result.Total != 2 || len(result.Tutors) != 2 || result.Tutors[0].ID != tutors[0].ID || result.Tutors[1].ID != tutors[1].ID {
+		t.Fatalf("Expected Ada then Ben, got %+v", result)
+	}
+	if !strings.Contains(result.Tutors[0].Snippet, "<mark>organic</mark>") {
+		t.Errorf("Expected organic to be highlighted, got %q", result.Tutors[0].Snippet)
+	}
+
+	page := search("q=chemistry&limit=1")
+	if page.Total != 2 || len(page.Tutors) != 1 || page.NextCursor == "" {
+		t.Fatalf("Expected 1 of 2 results and a cursor, got %+v", page)
+	}
+	next := search("q=chemistry&limit=1&cursor=" + page.NextCursor)
+	if len(next.Tutors) != 1 || next.Tutors[0].ID == page.Tutors[0].ID || next.NextCursor != "" {
+		t.Errorf("Expected the other result and no cursor, got %+v", next)
+	}
+
+	// Misspellings still match by similarity
+	if result := search("q=chemstry"); result.Total != 2 {
+		t.Errorf("Expected both chemistry tutors for a misspelling, got %+v", result)
+	}
+	if result := search("q=organa"); result.Total != 1 || result.Tutors[0].ID != tutors[0].ID {
+		t.Errorf("Expected to find Ada by name, got %+v", result)
+	}
+
+	result = search("q=abrsm")
+	if result.Total != 1 || strings.Contains(result.Tutors[0].Snippet, "<b>") || !strings.Contains(result.Tutors[0].Snippet, "<mark>") {
+		t.Errorf("Expected an escaped, highlighted snippet, got %+v", result)
+	}
+	if status := authRequest(t, "GET", baseURL+"/tutors/search", student, nil, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a query, got %d", status)
+	}
+}
+
+func TestNearbyTutors(t *testing.T) {
+	baseURL := fmt.Sprintf("http://localhost:%s/api", os.Getenv("SERVER_PORT"))
+	admin := login(t, baseURL, "admin@example.com", "password789")
+
+	fixtures := []struct {
+		location, mode string
+		travel         float64
+	}{
+		{"London", "", 0},
+		{"Cambridge, UK", models.LessonModeInPerson, 0}, // About 80 km from London
+		{"Birmingham", "", 180},                         // About 163 km from London, but travels there
+		{"Manchester", "", 0},                           // About 262 km from London
+		{"London", models.LessonModeOnline, 0},
+		{"Atlantis", "", 0},
+	}
+	tutors := make([]models.Tutor, len(fixtures))
+	for i, f := range fixtures {
+		user := models.User{Name: fmt.Sprintf("Nearby Tutor %d", i), Email: fmt.Sprintf("nearby-%d@example.com", i), Password: "password123", UserType: "tutor"}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("Error creating tutor user: %v", err)
+		}
+		body := map[string]interface{}{"UserID": user.ID, "Subject": "Nearbyology", "YearsExperience": 2, "HourlyRate": 30, "Location": f.location, "LessonMode": f.mode, "TravelRadiusKm": f.travel}
+		if status := authRequest(t, "POST", baseURL+"/tutors", admin, body, &tutors[i]); status != http.StatusCreated {
+			t.Fatalf("Expected status 201 creating a tutor in %s, got %d", f.location, status)
+		}
+	}
+	if tutors[0].Latitude == nil || tutors[0].Longitude == nil || tutors[5].Latitude != nil {
+		t.Fatalf("Expected London to be geocoded and Atlantis not, got %+v and %+v", tutors[0], tutors[5])
+	}
+	if tutors[0].LessonMode != models.LessonModeBoth {
+		t.Errorf("Expected the lesson mode to default to both, got %q", tutors[0].LessonMode)
+	}
+
+	type searchResponse struct {
+		Tutors     []models.Tutor `json:"tutors"`
+		Total      int64          `json:"total"`
+		NextCursor string         `json:"nextCursor"`
+	}
+	search := func(query string, token string) searchResponse {
+		t.Helper()
+		var result searchResponse
+		if status := authRequest(t, "GET", baseURL+"/tutors?subject=Nearbyology&"+query, token, nil, &result); status != http.StatusOK {
+			t.Fatalf("Expected status 200 searching with %q, got %d", query, status)
+		}
+		return result
+	}
+	ids := func(result searchResponse) []uint {
+		ids := []uint{}
+		for _, tutor := range result.Tutors {
+			ids = append(ids, tutor.ID)
+		}
+		return ids
+	}
+
+	// Online-only tutors, tutors too far away and tutors without
+	// coordinates are left out; tutors who travel far enough are not
+	london := "near=51.5074,-0.1278&radius_km=100"
+	result := search(london+"&sort=distance", admin)
+	if got, want := ids(result), []uint{tutors[0].ID, tutors[1].ID, tutors[2].ID}; fmt.Sprint(got) != fmt.Sprint(want) || result.Total != 3 {
+		t.Fatalf("Expected tutors %v nearest first, got %v", want, got)
+	}
+	distances := []float64{}
+	for _, tutor := range result.Tutors {
+		if tutor.DistanceKm == nil {
+			t.Fatalf("Expected a distance for tutor %d", tutor.ID)
+		}
+		distances = append(distances, *tutor.DistanceKm)
+	}
+	if distances[0] != 0 || distances[1] < 75 || distances[1] > 85 || distances[2] < 155 || distances[2] > 170 {
+		t.Errorf("Expected distances of about 0, 80 and 163 km, got %v", distances)
+	}
+
+	page := search(london+"&sort=distance&limit=2", admin)
+	if len(page.Tutors) != 2 || page.NextCursor == "" {
+		t.Fatalf("Expected 2 results and a cursor, got %+v", page)
+	}
+	next := search(london+"&sort=distance&limit=2&cursor="+page.NextCursor, admin)
+	if got := ids(next); len(got) != 1 || got[0] != tutors[2].ID || next.NextCursor != "" {
+		t.Errorf("Expected Birmingham alone on the next page, got %v", got)
+	}
+
+	if result := search("mode=online", admin); result.Total != 5 {
+		t.Errorf("Expected 5 tutors teaching online, got %v", ids(result))
+	}
+	if result := search("mode=in_person", admin); result.Total != 5 {
+		t.Errorf("Expected 5 tutors teaching in person, got %v", ids(result))
+	}
+
+	// Full-text search gives distances too
+	var matches struct {
+		Tutors []models.Tutor `json:"tutors"`
+	}
+	if status := authRequest(t, "GET", baseURL+"/tutors/search?q=nearbyology&"+london, admin, nil, &matches); status != http.StatusOK || len(matches.Tutors) != 3 || matches.Tutors[0].DistanceKm == nil {
+		t.Errorf("Expected 3 matches with distances, got %d: %+v", status, matches)
+	}
+
+	// Moving a tutor geocodes their new location
+	var moved models.Tutor
+	if status := authRequest(t, "PUT", fmt.Sprintf("%s/tutors/%d", baseURL, tutors[3].ID), admin, map[string]interface{}{"Location": "Oxford"}, &moved); status != http.StatusOK || moved.Latitude == nil || *moved.Latitude == *tutors[3].Latitude {
+		t.Fatalf("Expected new coordinates after moving to Oxford, got %d: %+v", status, moved)
+	}
+	if result := search(london, admin); result.Total != 4 {
+		t.Errorf("Expected the tutor in Oxford to be near London, got %v", ids(result))
+	}
+
+	// Students may search near their own location
+	user := models.User{Name: "Nearby Student", Email: "nearby-student@example.com", Password: "password123", UserType: "student"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Error creating student user: %v", err)
+	}
+	student := login(t, baseURL, user.Email, "password123")
+	if status := authRequest(t, "GET", baseURL+"/tutors?near=me", student, nil, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 searching near an unknown location, got %d", status)
+	}
+	if status := authRequest(t, "POST", baseURL+"/students", student, map[string]interface{}{"Age": 16, "Subjects": "Nearbyology", "Location": "Cambridge"}, nil); status != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating a student, got %d", status)
+	}
+	result = search("near=me&radius_km=10&sort=distance", student)
+	if got, want := ids(result), []uint{tutors[1].ID, tutors[2].ID}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected the Cambridge tutor, then Birmingham's who travels, got %v", got)
+	}
+
+	for _, query := range []string{"near=abc", "near=91,0", "near=51.5,-0.1&radius_km=0", "near=51.5,-0.1&radius_km=1000", "sort=distance", "mode=teleport"} {
+		if status := authRequest(t, "GET", baseURL+"/tutors?"+query, admin, nil, nil); status != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %q, got %d", query, status)
+		}
+	}
+	for _, body := range []map[string]interface{}{{"LessonMode": "teleport"}, {"TravelRadiusKm": 500}} {
+		if status := authRequest(t, "PUT", fmt.Sprintf("%s/tutors/%d", baseURL, tutors[0].ID), admin, body, nil); status != http.StatusBadRequest {
+			t.Errorf("Expected status 400 updating with %v, got %d", body, status)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/OPTIC7409/tutor-api/internal/geocode"
+)
+
+func TestStaticGeocoder(t *testing.T) {
+	geocoder := geocode.NewStatic()
+	london := geocoder["london"]
+
+	for _, place := range []string{"London", "  new   YORK ", "Cambridge, UK"} {
+		if _, err := geocoder.Geocode(context.Background(), place); err != nil {
+			t.Errorf("Expected to find %q, got %v", place, err)
+		}
+	}
+	if point, _ := geocoder.Geocode(context.Background(), "london, england"); point != london {
+		t.Errorf("Expected London's coordinates, got %+v", point)
+	}
+	for _, place := range []string{"Online", "", "Atlantis, London"} {
+		if _, err := geocoder.Geocode(context.Background(), place); !errors.Is(err, geocode.ErrNotFound) {
+			t.Errorf("Expected %q not to be found, got %v", place, err)
+		}
+	}
+}
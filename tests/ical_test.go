@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/ical"
+)
+
+func TestICalendarEncoding(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("Error loading time zone: %v", err)
+	}
+
+	calendar := ical.Calendar{Name: "Sessions", Events: []ical.Event{{
+		UID:         "session-1@tutor-api",
+		Sequence:    2,
+		Summary:     "Maths; algebra, then geometry with a description long enough to need folding",
+		Description: "Bring a calculator\rX-INJECTED:1\r\nand a ruler\nplease",
+		Status:      ical.StatusCancelled,
+		Start:       time.Date(2024, 3, 30, 9, 0, 0, 0, london),
+		End:         time.Date(2024, 4, 2, 10, 0, 0, 0, london),
+		Location:    london,
+	}}}
+	out := string(calendar.Marshal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	for _, want := range []string{
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/London\r\n",
+		"BEGIN:DAYLIGHT\r\nDTSTART:20240331T010000\r\nTZOFFSETFROM:+0000\r\nTZOFFSETTO:+0100\r\nTZNAME:BST\r\n",
+		"DTSTART;TZID=Europe/London:20240330T090000\r\n",
+		"DTEND;TZID=Europe/London:20240402T100000\r\n",
+		"UID:session-1@tutor-api\r\n",
+		"SEQUENCE:2\r\n",
+		"STATUS:CANCELLED\r\n",
+		`SUMMARY:Maths\; algebra\, then geometry`,
+		`DESCRIPTION:Bring a calculator\nX-INJECTED:1\nand a ruler\nplease`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected calendar to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	if strings.Count(out, "\r") != strings.Count(out, "\r\n") {
+		t.Errorf("Expected every CR to end a content line, got:\n%q", out)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Expected lines of at most 75 octets, got %q", line)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/loginguard"
+)
+
+func TestLoginGuardBackoffAndLockout(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	guard := loginguard.New(loginguard.NewMemoryStore(), loginguard.Policy{
+		FreeAttempts:     2,
+		BaseDelay:        time.Second,
+		MaxDelay:         4 * time.Second,
+		LockoutThreshold: 6,
+		LockoutDuration:  time.Minute,
+		Window:           time.Hour,
+	})
+	guard.Now = func() time.Time { return now }
+	key := loginguard.AccountKey("Guard@Example.com ")
+
+	fail := func() bool {
+		t.Helper()
+		locked, err := guard.Fail(ctx, key)
+		if err != nil {
+			t.Fatalf("Error recording failure: %v", err)
+		}
+		return locked
+	}
+	check := func() (time.Duration, bool) {
+		t.Helper()
+		wait, locked, err := guard.Check(ctx, key)
+		if err != nil {
+			t.Fatalf("Error checking key: %v", err)
+		}
+		return wait, locked
+	}
+
+	fail()
+	fail()
+	if wait, _ := check(); wait != 0 {
+		t.Fatalf("Expected free attempts not to be delayed, got %s", wait)
+	}
+
+	// Each failure past the free attempts doubles the delay up to the cap
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		fail()
+		if wait, locked := check(); wait != expected || locked {
+			t.Fatalf("Expected a %s delay, got %s (locked %v)", expected, wait, locked)
+		}
+		now = now.Add(expected)
+	}
+
+	if !fail() {
+		t.Fatalf("Expected the threshold failure to lock the key")
+	}
+	if wait, locked := check(); !locked || wait != time.Minute {
+		t.Fatalf("Expected a one minute lockout, got %s (locked %v)", wait, locked)
+	}
+
+	if err := guard.Unlock(ctx, key); err != nil {
+		t.Fatalf("Error unlocking key: %v", err)
+	}
+	if wait, locked := check(); wait != 0 || locked {
+		t.Fatalf("Expected unlock to clear the key, got %s (locked %v)", wait, locked)
+	}
+
+	// Old failures are forgotten once the window has passed
+	fail()
+	fail()
+	fail()
+	now = now.Add(2 * time.Hour)
+	if wait, _ := check(); wait != 0 {
+		t.Errorf("Expected failures outside the window to be ignored, got %s", wait)
+	}
+	fail()
+	if wait, _ := check(); wait != 0 {
+		t.Errorf("Expected the counter to restart after the window, got %s", wait)
+	}
+}
@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/oidc"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// mockOIDCProvider is a minimal OpenID Connect provider: it serves discovery,
+// JWKS and a token endpoint that enforces PKCE.
+type mockOIDCProvider struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu          sync.Mutex
+	codes       map[string]mockAuthorization
+	jwksFetches int
+}
+
+type mockAuthorization struct {
+	challenge string
+	nonce     string
+	subject   string
+	email     string
+}
+
+func newMockOIDCProvider(t *testing.T, clientID string) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+
+	m := &mockOIDCProvider{key: key, clientID: clientID, codes: map[string]mockAuthorization{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.jwksFetches++
+		m.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "mock-key",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+// authorize simulates the user signing in at the provider for the given
+// authorization URL and returns the code sent back to the client.
+func (m *mockOIDCProvider) authorize(t *testing.T, authURL, subject, email string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Invalid authorization URL: %v", err)
+	}
+
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != m.clientID {
+		t.Fatalf("Authorization URL is missing PKCE or client parameters: %s", authURL)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code := "code-" + subject
+	m.codes[code] = mockAuthorization{
+		challenge: q.Get("code_challenge"),
+		nonce:     q.Get("nonce"),
+		subject:   subject,
+		email:     email,
+	}
+	return code
+}
+
+func (m *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	m.mu.Lock()
+	auth, ok := m.codes[r.Form.Get("code")]
+	delete(m.codes, r.Form.Get("code"))
+	m.mu.Unlock()
+
+	if !ok || oidc.S256Challenge(r.Form.Get("code_verifier")) != auth.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.URL,
+		"aud":            m.clientID,
+		"sub":            auth.subject,
+		"email":          auth.email,
+		"email_verified": true,
+		"name":           "Mock Student",
+		"nonce":          auth.nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	})
+	idToken.Header["kid"] = "mock-key"
+	signed, _ := idToken.SignedString(m.key)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "mock-access-token",
+		"id_token":     signed,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func TestOIDCAuthorizationCodeFlow(t *testing.T) {
+	mock := newMockOIDCProvider(t, "tutor-api")
+	provider := oidc.NewProvider("mock", mock.URL, "tutor-api", "secret", "http://localhost/api/auth/oidc/mock/callback")
+	ctx := context.Background()
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatalf("Error creating PKCE pair: %v", err)
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce-123", challenge)
+	if err != nil {
+		t.Fatalf("Error building authorization URL: %v", err)
+	}
+
+	code := mock.authorize(t, authURL, "subject-1", "oidc@example.com")
+	if _, err := provider.Exchange(ctx, code, "wrong-verifier"); err == nil {
+		t.Fatalf("Expected exchange with the wrong PKCE verifier to fail")
+	}
+
+	code = mock.authorize(t, authURL, "subject-1", "oidc@example.com")
+	tokens, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("Error exchanging code: %v", err)
+	}
+
+	if _, err := provider.VerifyIDToken(ctx, tokens.IDToken, "other-nonce"); err == nil {
+		t.Errorf("Expected ID token with a different nonce to be rejected")
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, tokens.IDToken, "nonce-123")
+	if err != nil {
+		t.Fatalf("Error verifying ID token: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "oidc@example.com" || !claims.IsEmailVerified() {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+
+	// Unknown kids do not make the provider fetch the JWKS again right away
+	for i := 0; i < 3; i++ {
+		forged := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"iss": mock.URL, "aud": "tutor-api", "sub": "subject-1", "nonce": "nonce-123"})
+		forged.Header["kid"] = fmt.Sprintf("forged-%d", i)
+		signed, _ := forged.SignedString(mock.key)
+		if _, err := provider.VerifyIDToken(ctx, signed, "nonce-123"); err == nil {
+			t.Errorf("Expected ID token with an unknown kid to be rejected")
+		}
+	}
+	mock.mu.Lock()
+	fetches := mock.jwksFetches
+	mock.mu.Unlock()
+	if fetches != 1 {
+		t.Errorf("Expected the JWKS to be fetched once, got %d", fetches)
+	}
+
+	other := oidc.NewProvider("mock", mock.URL, "another-client", "secret", "http://localhost/callback")
+	if _, err := other.VerifyIDToken(ctx, tokens.IDToken, "nonce-123"); err == nil {
+		t.Errorf("Expected ID token issued to another client to be rejected")
+	}
+}
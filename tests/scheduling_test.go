@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/scheduling"
+)
+
+func TestSchedulingAcrossDaylightSaving(t *testing.T) {
+	london, err := scheduling.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("Error loading time zone: %v", err)
+	}
+
+	// Clocks go forward at 01:00 UTC on Sunday 31 March 2024
+	windows := []scheduling.Window{
+		{Weekday: time.Saturday, Start: 9 * 60, End: 17 * 60},
+		{Weekday: time.Sunday, Start: 9 * 60, End: 17 * 60},
+		{Weekday: time.Sunday, Start: 0, End: 3 * 60},
+	}
+	from := time.Date(2024, 3, 30, 0, 0, 0, 0, london)
+	to := time.Date(2024, 4, 1, 0, 0, 0, 0, london)
+	free := scheduling.Expand(windows, london, from, to)
+	if len(free) != 3 {
+		t.Fatalf("Expected 3 intervals, got %+v", free)
+	}
+	for _, i := range []int{0, 2} {
+		if start := free[i].Start.In(london); start.Hour() != 9 || free[i].End.Sub(free[i].Start) != 8*time.Hour {
+			t.Errorf("Expected 09:00 to 17:00 local time, got %s to %s", start, free[i].End.In(london))
+		}
+	}
+	if free[0].Start.UTC().Hour() != 9 || free[2].Start.UTC().Hour() != 8 {
+		t.Errorf("Expected the UTC offset to move with the clocks, got %s and %s", free[0].Start.UTC(), free[2].Start.UTC())
+	}
+	if length := free[1].End.Sub(free[1].Start); length != 2*time.Hour {
+		t.Errorf("Expected the window spanning the transition to lose an hour, got %s", length)
+	}
+
+	// Clocks go back at 01:00 UTC on Sunday 27 October 2024
+	from = time.Date(2024, 10, 27, 0, 0, 0, 0, london)
+	to = time.Date(2024, 10, 28, 0, 0, 0, 0, london)
+	free = scheduling.Expand(windows[2:], london, from, to)
+	if len(free) != 1 || free[0].End.Sub(free[0].Start) != 4*time.Hour {
+		t.Fatalf("Expected the window spanning the transition to gain an hour, got %+v", free)
+	}
+	slots := scheduling.Slots(free, time.Hour, 30*time.Minute)
+	if len(slots) != 7 {
+		t.Errorf("Expected 7 hourly slots every 30 minutes, got %d", len(slots))
+	}
+
+	// Booked time is removed and the remaining free time is split up
+	free = scheduling.Expand(windows[1:2], london, from, to)
+	busy := []scheduling.Interval{{
+		Start: time.Date(2024, 10, 27, 12, 0, 0, 0, london),
+		End:   time.Date(2024, 10, 27, 13, 30, 0, 0, london),
+	}}
+	free = scheduling.Subtract(free, busy)
+	if len(free) != 2 || !free[0].End.Equal(busy[0].Start) || !free[1].Start.Equal(busy[0].End) {
+		t.Fatalf("Expected free time either side of the session, got %+v", free)
+	}
+	if slots := scheduling.Slots(free, time.Hour, time.Hour); len(slots) != 6 {
+		t.Errorf("Expected 6 hourly slots, got %d", len(slots))
+	}
+}
+
+func TestRecurKeepsWallClockTime(t *testing.T) {
+	london, err := scheduling.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("Error loading time zone: %v", err)
+	}
+
+	// Fortnightly at 18:00 from before to after the clocks go forward
+	start := time.Date(2024, 3, 12, 18, 0, 0, 0, london)
+	occurrences := scheduling.Recur(start, london, 2, 3, time.Time{}, 10)
+	if len(occurrences) != 3 {
+		t.Fatalf("Expected 3 occurrences, got %d", len(occurrences))
+	}
+	for i, o := range occurrences {
+		if local := o.In(london); local.Hour() != 18 || local.Weekday() != time.Tuesday {
+			t.Errorf("Expected occurrence %d on a Tuesday at 18:00, got %s", i, local)
+		}
+	}
+	if gap := occurrences[2].Sub(occurrences[1]); gap != 14*24*time.Hour-time.Hour {
+		t.Errorf("Expected the fortnight spanning the transition to be an hour short, got %s", gap)
+	}
+
+	// until is inclusive
+	until := time.Date(2024, 4, 2, 18, 0, 0, 0, london)
+	if occurrences := scheduling.Recur(start, london, 1, 0, until, 10); len(occurrences) != 4 {
+		t.Errorf("Expected 4 weekly occurrences up to until, got %d", len(occurrences))
+	}
+
+	// A distant until stops at max instead of reaching it
+	far := time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	if occurrences := scheduling.Recur(start, london, 1, 0, far, 53); len(occurrences) != 53 {
+		t.Errorf("Expected occurrences to stop at 53, got %d", len(occurrences))
+	}
+	if occurrences := scheduling.Recur(start, london, 1, 100, time.Time{}, 53); len(occurrences) != 53 {
+		t.Errorf("Expected count to be capped at 53, got %d", len(occurrences))
+	}
+}
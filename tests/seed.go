@@ -1,8 +1,9 @@
 package tests
 
 import (
+	"time"
+
 	"github.com/OPTIC7409/tutor-api/internal/models"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -11,18 +12,15 @@ func SeedDatabase(db *gorm.DB) error {
 		return err
 	}
 
+	verifiedAt := time.Now()
 	users := []models.User{
-		{Name: "John Doe", Email: "john@example.com", Password: "password123", UserType: "student"},
-		{Name: "Jane Smith", Email: "jane@example.com", Password: "password456", UserType: "tutor"},
+		{Name: "John Doe", Email: "john@example.com", Password: "password123", UserType: "student", EmailVerifiedAt: &verifiedAt},
+		{Name: "Jane Smith", Email: "jane@example.com", Password: "password456", UserType: "tutor", EmailVerifiedAt: &verifiedAt},
+		{Name: "Alex Admin", Email: "admin@example.com", Password: "password789", UserType: "admin", EmailVerifiedAt: &verifiedAt},
 	}
 
 	for i := range users {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(users[i].Password), bcrypt.DefaultCost)
-		if err != nil {
-			return err
-		}
-		users[i].Password = string(hashedPassword)
-
+		// The User model's BeforeSave hook hashes the password
 		if err := db.FirstOrCreate(&users[i], models.User{Email: users[i].Email}).Error; err != nil {
 			return err
 		}
@@ -43,7 +41,7 @@ func SeedDatabase(db *gorm.DB) error {
 		return err
 	}
 
-	for _, user := range users {
+	for _, user := range users[:2] {
 		if err := db.Model(&chat).Association("Participants").Append(&user); err != nil {
 			return err
 		}
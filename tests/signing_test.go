@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/OPTIC7409/tutor-api/internal/jwk"
+	"github.com/OPTIC7409/tutor-api/internal/models"
+	"github.com/OPTIC7409/tutor-api/internal/signing"
+	"github.com/OPTIC7409/tutor-api/internal/utils"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestJWKSVerifiesAccessTokens(t *testing.T) {
+	serverURL := fmt.Sprintf("http://localhost:%s", os.Getenv("SERVER_PORT"))
+	token := login(t, serverURL+"/api", "john@example.com", "password123")
+
+	resp, err := http.Get(serverURL + "/.well-known/jwks.json")
+	if err != nil {
+		t.Fatalf("Error fetching JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var set jwk.Set
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		t.Fatalf("Error decoding JWKS: %v", err)
+	}
+	keys, err := set.PublicKeys()
+	if err != nil {
+		t.Fatalf("Error decoding keys: %v", err)
+	}
+
+	// Verify the way another service would: by kid, without any secret
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	})
+	if err != nil {
+		t.Fatalf("Access token does not verify against the JWKS: %v", err)
+	}
+	if claims["user_id"] == nil {
+		t.Errorf("Expected user_id claim, got %v", claims)
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	for _, algorithm := range []string{signing.AlgorithmRS256, signing.AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			keys, err := signing.NewKeyManager(db, signing.Options{
+				Algorithm:        algorithm,
+				RotationInterval: time.Hour,
+				VerifyGrace:      time.Hour,
+			})
+			if err != nil {
+				t.Fatalf("Error creating key manager: %v", err)
+			}
+
+			claims := jwt.RegisteredClaims{Subject: "1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+			before, err := keys.Sign(claims)
+			if err != nil {
+				t.Fatalf("Error signing: %v", err)
+			}
+
+			if err := keys.Rotate(ctx); err != nil {
+				t.Fatalf("Error rotating keys: %v", err)
+			}
+			after, err := keys.Sign(claims)
+			if err != nil {
+				t.Fatalf("Error signing: %v", err)
+			}
+
+			kids := map[string]bool{}
+			for _, raw := range []string{before, after} {
+				token, err := jwt.ParseWithClaims(raw, &jwt.RegisteredClaims{}, keys.Keyfunc)
+				if err != nil {
+					t.Fatalf("Expected token to verify after rotation: %v", err)
+				}
+				if token.Method.Alg() != algorithm {
+					t.Errorf("Expected %s token, got %s", algorithm, token.Method.Alg())
+				}
+				kids[token.Header["kid"].(string)] = true
+			}
+			if len(kids) != 2 {
+				t.Errorf("Expected the rotated key to sign new tokens")
+			}
+
+			set, err := keys.JWKS()
+			if err != nil {
+				t.Fatalf("Error building JWKS: %v", err)
+			}
+			published, err := set.PublicKeys()
+			if err != nil {
+				t.Fatalf("Error decoding JWKS: %v", err)
+			}
+			for kid := range kids {
+				if published[kid] == nil {
+					t.Errorf("Expected key %s to be published", kid)
+				}
+			}
+		})
+	}
+}
+
+func TestSigningKeysOutliveTokens(t *testing.T) {
+	options := signing.DefaultOptions(signing.AlgorithmRS256, time.Hour)
+	if options.VerifyGrace < signing.MaxTokenTTL {
+		t.Errorf("Expected keys to be published for at least %v after signing, got %v", signing.MaxTokenTTL, options.VerifyGrace)
+	}
+	if _, err := utils.GenerateScopedToken(nil, &models.User{}, 0, nil, signing.MaxTokenTTL+time.Second); err == nil {
+		t.Errorf("Expected a token outliving its signing key to be refused")
+	}
+}
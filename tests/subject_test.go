@@ -0,0 +1,29 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/OPTIC7409/tutor-api/internal/models"
+)
+
+func TestSplitSubjects(t *testing.T) {
+	cases := map[string][][]string{
+		"Mathematics":                       {{"Mathematics"}},
+		"Maths, Physics; Chemistry":         {{"Maths"}, {"Physics"}, {"Chemistry"}},
+		"Maths > GCSE; maths>gcse\nBiology": {{"Maths", "GCSE"}, {"Biology"}},
+		"English  Literature, French":       {{"English Literature"}, {"French"}},
+		"Music/Piano, , ":                   {{"Music", "Piano"}},
+		"":                                  nil,
+
+		// "and" and "&" belong to the names
+		"Design and Technology, Business & Economics":   {{"Design and Technology"}, {"Business & Economics"}},
+		"Health and Social Care > BTEC\nArt and Design": {{"Health and Social Care", "BTEC"}, {"Art and Design"}},
+	}
+
+	for text, want := range cases {
+		if got := models.SplitSubjects(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("SplitSubjects(%q) = %q, want %q", text, got, want)
+		}
+	}
+}